@@ -4,101 +4,124 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strings"
 
 	"github.com/jsphweid/harmondex/chord"
 	"github.com/jsphweid/harmondex/constants"
-	"github.com/jsphweid/harmondex/db"
-	"github.com/jsphweid/harmondex/midi"
 	"github.com/jsphweid/harmondex/model"
 	"github.com/jsphweid/harmondex/util"
 )
 
-func maybePutChordInBuckets(c model.Chord) {
-	// TODO: bucketize other methods? 1. transposed, 2. note classes
+const bucketBufferSize = 64 * 1024
 
-	// order them
-	sort.Slice(c.Notes, func(i, j int) bool {
-		return c.Notes[i] < c.Notes[j]
-	})
+// buckets without a prefix hold chords keyed by chord.CreateChordKey
+const transposedBucketPrefix = "t"
+const pitchClassBucketPrefix = "p"
 
-	bytes := chord.Serialize(c)
+var bucketFilenameRegex = regexp.MustCompile(`^[pt]?\d\d\d\.dat$`)
 
-	filename := fmt.Sprintf("%v/%03d.dat", util.GetIndexDir(), c.Notes[0])
-	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0777)
-	if err != nil {
-		panic("Could not open bucket because: " + err.Error())
-	}
-	defer f.Close()
+func IsBucketFile(filename string) bool {
+	return bucketFilenameRegex.MatchString(filename)
+}
 
-	if _, err = f.Write(bytes[:]); err != nil {
-		panic("Could not write chord to bucket because: " + err.Error())
+// GetChordKeyFunc returns the function that makes keys for the chords in
+// the bucket at path
+func GetChordKeyFunc(path string) chord.KeyFunc {
+	filename := filepath.Base(path)
+	switch {
+	case strings.HasPrefix(filename, transposedBucketPrefix):
+		return chord.CreateTransposedChordKey
+	case strings.HasPrefix(filename, pitchClassBucketPrefix):
+		return chord.CreatePitchClassKey
 	}
+	return chord.CreateChordKey
 }
 
-func fileHasMetadata(filename string) bool {
-	metadatas := db.GetMidiMetadatas([]string{filename})
-	if _, ok := metadatas[filename]; ok {
-		return true
-	}
-	return false
+func getBucketPath(prefix string, num uint8) string {
+	return fmt.Sprintf("%v/%v%03d.dat", util.GetBucketDir(), prefix, num)
 }
 
-func processMidiFile(fileNum uint32, filename string) {
-	path := filepath.Join(util.GetMediaDir(), filename)
-	parsed, err := midi.ReadMidiFile(path)
-	if err != nil {
-		fmt.Printf("Skipping %v because: %v\n", filename, err)
-		return
+// bucketWriter keeps every bucket open and buffered while indexing instead
+// of opening a bucket for every chord
+type bucketWriter struct {
+	files   map[string]*os.File
+	writers map[string]*bufio.Writer
+}
+
+func newBucketWriter() *bucketWriter {
+	return &bucketWriter{
+		files:   make(map[string]*os.File),
+		writers: make(map[string]*bufio.Writer),
 	}
+}
 
-	hasMetadata := fileHasMetadata(filename)
-	chords, err := chord.GetChords(parsed, hasMetadata)
-	if err != nil {
-		fmt.Printf("Skipping %v because: %v\n", filename, err)
-		return
+func (bw *bucketWriter) write(filename string, bytes []byte) {
+	writer, ok := bw.writers[filename]
+	if !ok {
+		f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0777)
+		if err != nil {
+			panic("Could not open bucket because: " + err.Error())
+		}
+		writer = bufio.NewWriterSize(f, bucketBufferSize)
+		bw.files[filename] = f
+		bw.writers[filename] = writer
 	}
 
-	for _, chord := range chords {
-		chord.FileNum = uint32(fileNum)
-		maybePutChordInBuckets(chord)
+	if _, err := writer.Write(bytes); err != nil {
+		panic("Could not write chord to bucket because: " + err.Error())
 	}
 }
 
-func ProcessAllMidiFiles(m model.FileNumToMidiPath) {
-	keys := util.GetKeys(m)
-	for i, num := range keys {
-		fmt.Printf("Processing %v of %v midi files\n", i+1, len(keys))
-		processMidiFile(num, m[num])
+func (bw *bucketWriter) flush() {
+	for _, writer := range bw.writers {
+		if err := writer.Flush(); err != nil {
+			panic("Could not flush bucket because: " + err.Error())
+		}
 	}
 }
 
-func DeleteAll() {
-	outDir := util.GetIndexDir()
-	files, err := ioutil.ReadDir(outDir)
-	if err != nil {
-		panic("Could not read dir because: " + err.Error())
+func (bw *bucketWriter) close() {
+	bw.flush()
+	for _, f := range bw.files {
+		f.Close()
 	}
+}
 
-	r, _ := regexp.Compile(`^\d\d\d\.dat$`)
-	for _, file := range files {
-		filename := file.Name()
-		if r.MatchString(filename) {
-			os.Remove(filepath.Join(outDir, filename))
-		}
+func (bw *bucketWriter) maybePutChordInBuckets(c model.Chord) {
+	// order them
+	sort.Slice(c.Notes, func(i, j int) bool {
+		return c.Notes[i] < c.Notes[j]
+	})
+
+	bytes := chord.Serialize(c)
+
+	bw.write(getBucketPath("", c.Notes[0]), bytes)
+	// transposed keys all start with 0 so bucket on the first interval instead
+	bw.write(getBucketPath(transposedBucketPrefix, c.Notes[1]-c.Notes[0]), bytes)
+	bw.write(getBucketPath(pitchClassBucketPrefix, chord.GetPitchClasses(c.Notes)[0]), bytes)
+}
+
+// DeleteAll deletes every bucket along with the checkpoint describing them
+func DeleteAll() {
+	outDir := util.GetBucketDir()
+	for _, file := range readBucketDir() {
+		os.Remove(filepath.Join(outDir, file.Name()))
 	}
+	os.Remove(util.GetBucketCheckpointPath())
 }
 
-func ReadChords(path string) []model.Chord {
-	var res []model.Chord
+// ForEachChord calls fn with every chord in the bucket at path without
+// reading the whole bucket into memory
+func ForEachChord(path string, fn func(c model.Chord)) {
 	bucketFile := util.OpenFileOrPanic(path)
-	bucketReader := bufio.NewReader(bucketFile)
+	defer bucketFile.Close()
+	bucketReader := bufio.NewReaderSize(bucketFile, bucketBufferSize)
+	buf := make([]byte, constants.ChordSize)
 	for {
-		buf := make([]byte, constants.ChordSize)
 		_, err := io.ReadFull(bucketReader, buf)
 		if err == io.EOF {
 			break
@@ -106,10 +129,14 @@ func ReadChords(path string) []model.Chord {
 		if err != nil {
 			panic("Could not read chord from file: " + err.Error())
 		}
+		fn(chord.Deserialize(buf))
+	}
+}
 
-		buf = buf[:constants.ChordSize]
-		c := chord.Deserialize(buf)
+func ReadChords(path string) []model.Chord {
+	var res []model.Chord
+	ForEachChord(path, func(c model.Chord) {
 		res = append(res, c)
-	}
+	})
 	return res
 }
@@ -0,0 +1,66 @@
+package bucket
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+)
+
+func readCheckpoint() (model.BucketCheckpoint, bool) {
+	if !util.Exists(util.GetBucketCheckpointPath()) {
+		var cp model.BucketCheckpoint
+		cp.BucketSizes = make(map[string]int64)
+		return cp, false
+	}
+	return util.ReadBinaryOrPanic[model.BucketCheckpoint](util.GetBucketCheckpointPath()), true
+}
+
+func writeCheckpoint(numFilesDone int, files model.IndexedFiles) {
+	var cp model.BucketCheckpoint
+	cp.NumFilesDone = numFilesDone
+	cp.BucketSizes = make(map[string]int64)
+	cp.Files = files
+	for _, info := range readBucketDir() {
+		cp.BucketSizes[info.Name()] = info.Size()
+	}
+	util.ReplaceBinary(util.GetBucketCheckpointPath(), cp)
+}
+
+// restoreCheckpoint takes every chord that was put in buckets after the
+// checkpoint back out so those files can be put in buckets again
+func restoreCheckpoint(cp model.BucketCheckpoint) {
+	bucketDir := util.GetBucketDir()
+	for _, info := range readBucketDir() {
+		path := filepath.Join(bucketDir, info.Name())
+		size, ok := cp.BucketSizes[info.Name()]
+		if !ok {
+			os.Remove(path)
+		} else if info.Size() != size {
+			err := os.Truncate(path, size)
+			if err != nil {
+				panic("Could not restore bucket because: " + err.Error())
+			}
+		}
+	}
+}
+
+func readBucketDir() []os.FileInfo {
+	files, err := ioutil.ReadDir(util.GetBucketDir())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		panic("Could not read dir because: " + err.Error())
+	}
+
+	var res []os.FileInfo
+	for _, file := range files {
+		if IsBucketFile(file.Name()) {
+			res = append(res, file)
+		}
+	}
+	return res
+}
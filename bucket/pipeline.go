@@ -0,0 +1,203 @@
+package bucket
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/jsphweid/harmondex/chord"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/db"
+	"github.com/jsphweid/harmondex/file"
+	"github.com/jsphweid/harmondex/midi"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/tonality"
+	"github.com/jsphweid/harmondex/util"
+)
+
+type midiFileJob struct {
+	i       int // position in the order files are written to buckets
+	fileNum uint32
+	relPath string // relative to the media dir
+}
+
+type processedMidiFile struct {
+	midiFileJob
+	chords []model.Chord
+	key    model.Key
+
+	// empty if the file couldn't be read (or had no chords for notesHash)
+	contentHash string
+	notesHash   string
+}
+
+func fileHasMetadata(filename string) bool {
+	metadatas := db.GetMidiMetadatas([]string{filename})
+	if _, ok := metadatas[filename]; ok {
+		return true
+	}
+	return false
+}
+
+func processMidiFile(job midiFileJob) processedMidiFile {
+	res := processedMidiFile{midiFileJob: job}
+	path := filepath.Join(util.GetMediaDir(), job.relPath)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Printf("Skipping %v because: %v\n", job.relPath, err)
+		return res
+	}
+	res.contentHash = file.HashContent(b)
+
+	parsed, err := midi.ReadMidi(b)
+	if err != nil {
+		fmt.Printf("Skipping %v because: %v\n", job.relPath, err)
+		return res
+	}
+
+	hasMetadata := fileHasMetadata(job.relPath)
+	chords, err := chord.GetChords(parsed, hasMetadata)
+	if err != nil {
+		fmt.Printf("Skipping %v because: %v\n", job.relPath, err)
+		return res
+	}
+
+	for i := range chords {
+		chords[i].FileNum = job.fileNum
+	}
+	res.chords = chords
+	if len(chords) > 0 {
+		res.key = tonality.Estimate(chords)
+		res.notesHash = file.HashNotes(chords)
+	}
+	return res
+}
+
+// findDuplicate returns the num of the file already indexed with the same
+// content as processed, if there is one
+func findDuplicate(processed processedMidiFile, hashes model.FileHashToFileNum, dedupNotes bool) (uint32, bool) {
+	if num, ok := hashes[processed.contentHash]; ok && processed.contentHash != "" {
+		return num, true
+	}
+	if num, ok := hashes[processed.notesHash]; ok && dedupNotes && processed.notesHash != "" {
+		return num, true
+	}
+	return 0, false
+}
+
+// wasRemoved is whether processed has the same content as a file that was
+// removed from the index (or the same notes if dedupNotes)
+func wasRemoved(processed processedMidiFile, removed model.RemovedFiles, dedupNotes bool) bool {
+	if processed.contentHash != "" && removed.Hashes[processed.contentHash] {
+		return true
+	}
+	return dedupNotes && processed.notesHash != "" && removed.Hashes[processed.notesHash]
+}
+
+// ProcessAllMidiFiles puts the chords of every file in buckets and adds what
+// was learned about the files to indexed, which has the files that are
+// already in the index. Files with the same content as a file that was
+// already indexed (or the same notes if dedupNotes) are skipped and recorded
+// as alternate paths of it instead, and files with the content of a removed
+// file are skipped entirely. Files are parsed by numWorkers goroutines
+// but always written to buckets in file number order so the buckets come out
+// the same no matter how many workers there are. Progress is checkpointed so
+// if a previous call didn't finish, this picks up after the last file it
+// checkpointed.
+func ProcessAllMidiFiles(m model.FileNumToMidiPath, indexed model.IndexedFiles, numWorkers int, dedupNotes bool) model.IndexedFiles {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	fileNums := util.GetKeys(m)
+	sort.Slice(fileNums, func(i, j int) bool {
+		return fileNums[i] < fileNums[j]
+	})
+
+	os.MkdirAll(util.GetBucketDir(), 0777)
+	cp, ok := readCheckpoint()
+	restoreCheckpoint(cp)
+	numFilesDone := cp.NumFilesDone
+	res := indexed
+	if ok {
+		res = cp.Files
+	}
+	remaining := fileNums[numFilesDone:]
+
+	jobs := make(chan midiFileJob)
+	results := make(chan processedMidiFile, numWorkers)
+
+	// NOTE: limits how far ahead of the writer the workers can get so
+	// parsed files that are waiting to be written don't pile up
+	inFlight := make(chan bool, numWorkers*2)
+
+	go func() {
+		for i, num := range remaining {
+			inFlight <- true
+			jobs <- midiFileJob{i, num, m[num]}
+		}
+		close(jobs)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results <- processMidiFile(job)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	bw := newBucketWriter()
+	pending := make(map[int]processedMidiFile)
+	next := 0
+	for result := range results {
+		pending[result.i] = result
+		for {
+			file, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			fmt.Printf("Processing %v of %v midi files\n", numFilesDone+next+1, len(fileNums))
+			if wasRemoved(file, res.Removed, dedupNotes) {
+				fmt.Printf("Skipping %v because it was removed from the index\n", file.relPath)
+			} else if num, ok := findDuplicate(file, res.Hashes, dedupNotes); ok {
+				res.AlternatePaths[num] = append(res.AlternatePaths[num], file.relPath)
+			} else {
+				for _, c := range file.chords {
+					bw.maybePutChordInBuckets(c)
+				}
+				if len(file.chords) > 0 {
+					res.Keys[file.fileNum] = file.key
+				}
+				if file.contentHash != "" {
+					res.Hashes[file.contentHash] = file.fileNum
+				}
+				if file.notesHash != "" {
+					res.Hashes[file.notesHash] = file.fileNum
+				}
+			}
+			next += 1
+			<-inFlight
+
+			if (numFilesDone+next)%constants.FilesPerCheckpoint == 0 {
+				bw.flush()
+				writeCheckpoint(numFilesDone+next, res)
+			}
+		}
+	}
+	bw.close()
+	writeCheckpoint(len(fileNums), res)
+
+	return res
+}
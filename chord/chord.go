@@ -4,6 +4,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/jsphweid/harmondex/constants"
 	"github.com/jsphweid/harmondex/model"
@@ -13,10 +15,18 @@ import (
 
 type OnNotes = map[uint8]bool
 
-func CreateChordKey(notes []uint8) string {
-	sort.Slice(notes, func(i, j int) bool {
-		return notes[i] < notes[j]
-	})
+type KeyFunc = func(notes []uint8) string
+
+const TransposedKeyPrefix = "t:"
+
+const PitchClassKeyPrefix = "p:"
+
+// keys made by CreateChordKey start with a note, which sorts before both
+// prefixes, so they're all from ChordKeysStart up to ChordKeysEnd
+const ChordKeysStart = "0"
+const ChordKeysEnd = ":"
+
+func joinNotes(notes []uint8) string {
 	var res string
 	for i, note := range notes {
 		res += fmt.Sprintf("%v", note)
@@ -27,6 +37,93 @@ func CreateChordKey(notes []uint8) string {
 	return res
 }
 
+func CreateChordKey(notes []uint8) string {
+	sort.Slice(notes, func(i, j int) bool {
+		return notes[i] < notes[j]
+	})
+	return joinNotes(notes)
+}
+
+// ParseChordKey turns a key made by CreateChordKey back into notes
+func ParseChordKey(key string) []uint8 {
+	var res []uint8
+	for _, part := range strings.Split(key, "-") {
+		note, err := strconv.Atoi(part)
+		if err != nil {
+			panic("Could not parse chord key " + key + ": " + err.Error())
+		}
+		res = append(res, uint8(note))
+	}
+	return res
+}
+
+// IsChordKey reports whether key was made by CreateChordKey
+func IsChordKey(key string) bool {
+	return !strings.HasPrefix(key, TransposedKeyPrefix) && !strings.HasPrefix(key, PitchClassKeyPrefix)
+}
+
+// CreateTransposedChordKey makes a key out of the intervals above the lowest
+// note so the same chord shape has the same key at any transposition
+func CreateTransposedChordKey(notes []uint8) string {
+	sort.Slice(notes, func(i, j int) bool {
+		return notes[i] < notes[j]
+	})
+	intervals := make([]uint8, 0, len(notes))
+	for _, note := range notes {
+		intervals = append(intervals, note-notes[0])
+	}
+	return TransposedKeyPrefix + joinNotes(intervals)
+}
+
+// CreatePitchClassKey makes a key out of the set of pitch classes (0-11) in
+// the chord so any voicing, inversion or doubling has the same key
+func CreatePitchClassKey(notes []uint8) string {
+	pitchClasses := GetPitchClasses(notes)
+	return PitchClassKeyPrefix + joinNotes(pitchClasses)
+}
+
+// GetPitchClasses returns the sorted, unique pitch classes in notes
+func GetPitchClasses(notes []uint8) []uint8 {
+	var seen [12]bool
+	for _, note := range notes {
+		seen[note%12] = true
+	}
+	var res []uint8
+	for pc, ok := range seen {
+		if ok {
+			res = append(res, uint8(pc))
+		}
+	}
+	return res
+}
+
+// Distance counts the edits (adding a note, removing a note or moving a note
+// by a semitone) it takes to turn one sorted set of notes into another
+func Distance(a []uint8, b []uint8) int {
+	// NOTE: since both are sorted, the cheapest edits never cross each other
+	// so this can be done like a regular edit distance
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			best := util.Min(prev[j]+1, curr[j-1]+1)
+			diff := int(a[i-1]) - int(b[j-1])
+			if diff == 0 {
+				best = util.Min(best, prev[j-1])
+			} else if diff == 1 || diff == -1 {
+				best = util.Min(best, prev[j-1]+1)
+			}
+			curr[j] = best
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
 func getChord(pressed map[uint8]int64, evt model.ReducedEvent, hasMetadata bool) model.Chord {
 	var notes []uint8
 	var c model.Chord
@@ -118,10 +215,11 @@ func GetChords(s *smf.SMF, hasMetadata bool) ([]model.Chord, error) {
 		// check if pressed should be added
 		if i > 0 && evt.AbsTimeMicro > lastEvent.AbsTimeMicro+constants.NewChordThreshold {
 			// ignore really short or really long chords
-			if len(pressed) >= 2 && len(pressed) <= 16 {
+			if len(pressed) >= constants.MinChordSize && len(pressed) <= constants.MaxChordSize {
 				c := getChord(pressed, lastEvent, hasMetadata)
 				key := CreateChordKey(c.Notes)
 				if key != lastChordKey {
+					c.SeqNum = uint32(len(res))
 					res = append(res, c)
 				}
 				lastChordKey = key
@@ -194,13 +292,23 @@ func createChordFlags(chord model.Chord) model.ChordFlag {
 	return cf
 }
 
+// SerializeFlags packs the flags of a chord into a single byte
+func SerializeFlags(chord model.Chord) uint8 {
+	return serializeChordFlags(createChordFlags(chord))
+}
+
+func DeserializeFlags(num uint8) model.ChordFlag {
+	return deserializeChordFlags(num)
+}
+
 func Serialize(chord model.Chord) []byte {
 	res := make([]byte, constants.ChordSize)
 	cf := createChordFlags(chord)
 	copy(res[0:16], chord.Notes)
 	binary.LittleEndian.PutUint32(res[16:20], chord.AbsTickOffset)
 	binary.LittleEndian.PutUint32(res[20:24], chord.FileNum)
-	res[24] = serializeChordFlags(cf)
+	binary.LittleEndian.PutUint32(res[24:28], chord.SeqNum)
+	res[28] = serializeChordFlags(cf)
 	return res
 }
 
@@ -209,28 +317,43 @@ func Deserialize(bytes []byte) model.Chord {
 	chord.Notes = util.FilterZeros(bytes[:16])
 	chord.AbsTickOffset = binary.LittleEndian.Uint32(bytes[16:20])
 	chord.FileNum = binary.LittleEndian.Uint32(bytes[20:24])
+	chord.SeqNum = binary.LittleEndian.Uint32(bytes[24:28])
 
-	cf := deserializeChordFlags(bytes[24])
+	cf := deserializeChordFlags(bytes[28])
 	chord.FileHasMetadata = cf.FileHasMetadata
 	chord.FormedByNoteOn = cf.FormedByNoteOn
 	chord.OldestEventWithin1Sec = cf.OldestEventWithin1Sec
 	return chord
 }
 
+func GetRankScore(chord model.Chord) uint8 {
+	var score uint8
+	if chord.FileHasMetadata {
+		score += 1
+	}
+	if chord.FormedByNoteOn {
+		score += 3
+	}
+	if chord.OldestEventWithin1Sec {
+		score += 3
+	}
+	return score
+}
+
+// GetFlagsRankScore is the rank score of a chord with the serialized flags
+func GetFlagsRankScore(flags uint8) uint8 {
+	cf := deserializeChordFlags(flags)
+	return GetRankScore(model.Chord{
+		FileHasMetadata:       cf.FileHasMetadata,
+		FormedByNoteOn:        cf.FormedByNoteOn,
+		OldestEventWithin1Sec: cf.OldestEventWithin1Sec,
+	})
+}
+
 func RankSortChords(chords []model.Chord) {
 	// add scores
 	for i, chord := range chords {
-		var score uint8
-		if chord.FileHasMetadata {
-			score += 1
-		}
-		if chord.FormedByNoteOn {
-			score += 3
-		}
-		if chord.OldestEventWithin1Sec {
-			score += 3
-		}
-		chords[i].RankScore = score
+		chords[i].RankScore = GetRankScore(chord)
 	}
 
 	// sort
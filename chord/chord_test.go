@@ -101,6 +101,7 @@ func TestChordSerializeDeserialize(t *testing.T) {
 		AbsTickOffset:         1,
 		Notes:                 []uint8{1, 2, 3},
 		FileNum:               2,
+		SeqNum:                3,
 		FileHasMetadata:       true,
 		FormedByNoteOn:        true,
 		OldestEventWithin1Sec: true,
@@ -109,3 +110,50 @@ func TestChordSerializeDeserialize(t *testing.T) {
 	assert := assert.New(t)
 	assert.Equal(chord, Deserialize(Serialize(chord)))
 }
+
+func TestTransposedChordKeyIgnoresTransposition(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("t:0-4-7", CreateTransposedChordKey([]uint8{67, 60, 64}))
+	assert.Equal("t:0-4-7", CreateTransposedChordKey([]uint8{62, 66, 69}))
+	assert.NotEqual(CreateTransposedChordKey([]uint8{60, 64, 67}), CreateTransposedChordKey([]uint8{60, 63, 67}))
+}
+
+func TestPitchClassKeyIgnoresVoicing(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("p:0-4-7", CreatePitchClassKey([]uint8{60, 64, 67}))
+	assert.Equal("p:0-4-7", CreatePitchClassKey([]uint8{52, 60, 67, 72, 76}))
+	assert.Equal("p:0-4-7", CreatePitchClassKey([]uint8{4, 7, 12}))
+	assert.NotEqual(CreatePitchClassKey([]uint8{60, 64, 67}), CreatePitchClassKey([]uint8{62, 66, 69}))
+}
+
+func TestParseChordKey(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]uint8{60, 64, 67}, ParseChordKey(CreateChordKey([]uint8{67, 64, 60})))
+	assert.True(IsChordKey("60-64-67"))
+	assert.False(IsChordKey(CreateTransposedChordKey([]uint8{60, 64, 67})))
+	assert.False(IsChordKey(CreatePitchClassKey([]uint8{60, 64, 67})))
+}
+
+func TestDistance(t *testing.T) {
+	cases := []struct {
+		a        []uint8
+		b        []uint8
+		expected int
+	}{
+		{[]uint8{60, 64, 67}, []uint8{60, 64, 67}, 0},
+		{[]uint8{60, 64, 67}, []uint8{60, 63, 67}, 1},
+		{[]uint8{60, 64, 67}, []uint8{60, 64, 67, 70}, 1},
+		{[]uint8{60, 64, 67}, []uint8{60, 67}, 1},
+		{[]uint8{60, 64, 67}, []uint8{60, 62, 67}, 2},
+		{[]uint8{60, 64, 67}, []uint8{59, 63, 66}, 3},
+		{[]uint8{}, []uint8{60, 64}, 2},
+	}
+
+	for _, c := range cases {
+		name := fmt.Sprintf("distance between %v and %v", c.a, c.b)
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.expected, Distance(c.a, c.b))
+			assert.Equal(t, c.expected, Distance(c.b, c.a))
+		})
+	}
+}
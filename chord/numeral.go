@@ -0,0 +1,74 @@
+package chord
+
+import (
+	"errors"
+	"strings"
+)
+
+var majorScale = []uint8{0, 2, 4, 5, 7, 9, 11}
+var minorScale = []uint8{0, 2, 3, 5, 7, 8, 10}
+
+type numeral struct {
+	text   string
+	degree int // 0 based
+}
+
+// NOTE: longer numerals have to come first
+var numerals = []numeral{
+	{"VII", 6}, {"III", 2}, {"IV", 3}, {"VI", 5}, {"II", 1}, {"V", 4}, {"I", 0},
+}
+
+// ParseNumeral parses roman numerals like "ii", "V7", "bVII" or "vii°" into a
+// chord in the key of C (or C minor). Upper case numerals are major chords,
+// lower case ones are minor and anything after the numeral works like the
+// suffix of a chord symbol.
+func ParseNumeral(text string, isMinorKey bool) (Symbol, error) {
+	var s Symbol
+	s.Intervals = map[uint8]bool{0: true, 4: true, 7: true}
+
+	rest := strings.TrimSpace(text)
+	var shift uint8
+	for len(rest) > 0 && (rest[0] == 'b' || rest[0] == '#') {
+		if rest[0] == '#' {
+			shift += 1
+		} else {
+			shift += 11
+		}
+		rest = rest[1:]
+	}
+
+	degree := -1
+	for _, n := range numerals {
+		if strings.HasPrefix(rest, n.text) {
+			degree = n.degree
+		} else if strings.HasPrefix(rest, strings.ToLower(n.text)) {
+			degree = n.degree
+			s.Intervals = map[uint8]bool{0: true, 3: true, 7: true}
+		} else {
+			continue
+		}
+		rest = rest[len(n.text):]
+		break
+	}
+	if degree == -1 {
+		return s, errors.New("could not parse " + text + ": missing roman numeral")
+	}
+
+	scale := majorScale
+	if isMinorKey {
+		scale = minorScale
+	}
+	s.Root = (scale[degree] + shift) % 12
+	s.Bass = s.Root
+
+	// "o" is commonly typed instead of "°"
+	if strings.HasPrefix(rest, "o") {
+		rest = "°" + rest[1:]
+	}
+	err := applySuffix(rest, s.Intervals)
+	if err != nil {
+		return s, errors.New("could not parse " + text + ": " + err.Error())
+	}
+
+	return s, nil
+}
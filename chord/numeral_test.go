@@ -0,0 +1,46 @@
+package chord
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNumeral(t *testing.T) {
+	cases := []struct {
+		numeral      string
+		isMinorKey   bool
+		pitchClasses []uint8
+	}{
+		{"I", false, []uint8{0, 4, 7}},
+		{"ii", false, []uint8{2, 5, 9}},
+		{"V7", false, []uint8{2, 5, 7, 11}},
+		{"vi", false, []uint8{0, 4, 9}},
+		{"vii°", false, []uint8{2, 5, 11}},
+		{"viio", false, []uint8{2, 5, 11}},
+		{"bVII", false, []uint8{2, 5, 10}},
+		{"i", true, []uint8{0, 3, 7}},
+		{"III", true, []uint8{3, 7, 10}},
+		{"V", true, []uint8{2, 7, 11}},
+		{"iiø7", true, []uint8{0, 2, 5, 8}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.numeral, func(t *testing.T) {
+			s, err := ParseNumeral(c.numeral, c.isMinorKey)
+
+			assert := assert.New(t)
+			assert.Nil(err)
+			assert.Equal(c.pitchClasses, s.PitchClasses())
+		})
+	}
+}
+
+func TestParseNumeralErrors(t *testing.T) {
+	for _, numeral := range []string{"", "X", "Vxyz"} {
+		t.Run(numeral, func(t *testing.T) {
+			_, err := ParseNumeral(numeral, false)
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package chord
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+type Symbol struct {
+	Root uint8 // pitch class
+	Bass uint8 // pitch class, same as Root unless there's a slash
+
+	// semitones above the root, 0-11
+	Intervals map[uint8]bool
+}
+
+var noteNameToPitchClass = map[byte]uint8{
+	'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11,
+}
+
+type symbolToken struct {
+	text  string
+	apply func(intervals map[uint8]bool)
+}
+
+func add(nums ...uint8) func(map[uint8]bool) {
+	return func(intervals map[uint8]bool) {
+		for _, num := range nums {
+			intervals[num] = true
+		}
+	}
+}
+
+func replace(old uint8, new uint8) func(map[uint8]bool) {
+	return func(intervals map[uint8]bool) {
+		delete(intervals, old)
+		intervals[new] = true
+	}
+}
+
+func combine(fns ...func(map[uint8]bool)) func(map[uint8]bool) {
+	return func(intervals map[uint8]bool) {
+		for _, fn := range fns {
+			fn(intervals)
+		}
+	}
+}
+
+var diminished = combine(replace(4, 3), replace(7, 6))
+
+// NOTE: earlier tokens win so longer ones have to come first
+var symbolTokens = []symbolToken{
+	{"maj13", add(11, 2, 9)},
+	{"maj11", add(11, 2, 5)},
+	{"maj9", add(11, 2)},
+	{"maj7", add(11)},
+	{"M7", add(11)},
+	{"Δ7", add(11)},
+	{"Δ", add(11)},
+	{"maj", add()},
+	{"M", add()},
+	{"dim7", combine(diminished, add(9))},
+	{"°7", combine(diminished, add(9))},
+	{"dim", diminished},
+	{"°", diminished},
+	{"ø7", combine(diminished, add(10))},
+	{"ø", combine(diminished, add(10))},
+	{"aug", replace(7, 8)},
+	{"+", replace(7, 8)},
+	{"min", replace(4, 3)},
+	{"m", replace(4, 3)},
+	{"-", replace(4, 3)},
+	{"sus2", replace(4, 2)},
+	{"sus4", replace(4, 5)},
+	{"sus", replace(4, 5)},
+	{"add13", add(9)},
+	{"add11", add(5)},
+	{"add9", add(2)},
+	{"add6", add(9)},
+	{"add4", add(5)},
+	{"add2", add(2)},
+	{"b13", add(8)},
+	{"#11", add(6)},
+	{"b9", add(1)},
+	{"#9", add(3)},
+	{"b5", replace(7, 6)},
+	{"#5", replace(7, 8)},
+	{"13", add(10, 2, 9)},
+	{"11", add(10, 2, 5)},
+	{"9", add(10, 2)},
+	{"7", add(10)},
+	{"6/9", add(9, 2)},
+	{"6", add(9)},
+	{"5", func(intervals map[uint8]bool) { delete(intervals, 4) }},
+}
+
+func parseNoteName(s string) (uint8, string, error) {
+	if len(s) == 0 {
+		return 0, s, errors.New("missing note name")
+	}
+	pc, ok := noteNameToPitchClass[s[0]]
+	if !ok {
+		return 0, s, errors.New("unknown note name: " + s[:1])
+	}
+	s = s[1:]
+	for len(s) > 0 && (s[0] == '#' || s[0] == 'b') {
+		if s[0] == '#' {
+			pc = (pc + 1) % 12
+		} else {
+			pc = (pc + 11) % 12
+		}
+		s = s[1:]
+	}
+	return pc, s, nil
+}
+
+// ParseSymbol parses chord symbols like "C", "F#m7", "Cmaj7/E", "C6/9" or "G7b9"
+func ParseSymbol(text string) (Symbol, error) {
+	var s Symbol
+	s.Intervals = map[uint8]bool{0: true, 4: true, 7: true}
+
+	root, rest, err := parseNoteName(strings.TrimSpace(text))
+	if err != nil {
+		return s, errors.New("could not parse " + text + ": " + err.Error())
+	}
+	s.Root = root
+	s.Bass = root
+
+	// NOTE: the slash of 6/9 isn't a bass note but "C6/9/E" has one
+	if i := strings.LastIndex(rest, "/"); i != -1 && !(strings.HasSuffix(rest[:i], "6") && rest[i+1:] == "9") {
+		bass, extra, err := parseNoteName(rest[i+1:])
+		if err != nil || extra != "" {
+			return s, errors.New("could not parse bass note of " + text)
+		}
+		s.Bass = bass
+		rest = rest[:i]
+	}
+
+	err = applySuffix(rest, s.Intervals)
+	if err != nil {
+		return s, errors.New("could not parse " + text + ": " + err.Error())
+	}
+
+	return s, nil
+}
+
+// applySuffix applies everything after the root, like "maj7" or "7b9"
+func applySuffix(suffix string, intervals map[uint8]bool) error {
+	rest := strings.NewReplacer("(", "", ")", "", ",", "", " ", "").Replace(suffix)
+	for len(rest) > 0 {
+		found := false
+		for _, token := range symbolTokens {
+			if strings.HasPrefix(rest, token.text) {
+				token.apply(intervals)
+				rest = rest[len(token.text):]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("unknown suffix at: " + rest)
+		}
+	}
+
+	// an explicit major seventh wins over the minor seventh added by 9, 11 and 13
+	if intervals[11] {
+		delete(intervals, 10)
+	}
+
+	return nil
+}
+
+// PitchClasses returns the sorted pitch classes in the chord, including the bass
+func (s Symbol) PitchClasses() []uint8 {
+	var notes []uint8
+	for interval := range s.Intervals {
+		notes = append(notes, (s.Root+interval)%12)
+	}
+	notes = append(notes, s.Bass)
+	return GetPitchClasses(notes)
+}
+
+func (s Symbol) Transpose(semitones uint8) Symbol {
+	s.Root = (s.Root + semitones) % 12
+	s.Bass = (s.Bass + semitones) % 12
+	return s
+}
+
+// Notes voices the chord in close position with the bass in the octave
+// starting at middle C
+func (s Symbol) Notes() []uint8 {
+	bass := 60 + s.Bass
+	res := []uint8{bass}
+	var above []uint8
+	for _, pc := range s.PitchClasses() {
+		if pc != s.Bass {
+			above = append(above, bass+(pc+12-s.Bass)%12)
+		}
+	}
+	sort.Slice(above, func(i, j int) bool {
+		return above[i] < above[j]
+	})
+	return append(res, above...)
+}
@@ -0,0 +1,48 @@
+package chord
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSymbol(t *testing.T) {
+	cases := []struct {
+		symbol       string
+		pitchClasses []uint8
+		notes        []uint8
+	}{
+		{"C", []uint8{0, 4, 7}, []uint8{60, 64, 67}},
+		{"F/C", []uint8{0, 5, 9}, []uint8{60, 65, 69}},
+		{"Am", []uint8{0, 4, 9}, []uint8{69, 72, 76}},
+		{"Cmaj7/E", []uint8{0, 4, 7, 11}, []uint8{64, 67, 71, 72}},
+		{"C6/9", []uint8{0, 2, 4, 7, 9}, []uint8{60, 62, 64, 67, 69}},
+		{"Am6/9/C", []uint8{0, 4, 6, 9, 11}, []uint8{60, 64, 66, 69, 71}},
+		{"G7b9", []uint8{2, 5, 7, 8, 11}, []uint8{67, 68, 71, 74, 77}},
+		{"Bbm7b5", []uint8{1, 4, 8, 10}, []uint8{70, 73, 76, 80}},
+		{"D9sus4", []uint8{0, 2, 4, 7, 9}, []uint8{62, 64, 67, 69, 72}},
+		{"Ebmaj9", []uint8{2, 3, 5, 7, 10}, []uint8{63, 65, 67, 70, 74}},
+		{"C#dim7", []uint8{1, 4, 7, 10}, []uint8{61, 64, 67, 70}},
+		{"C/D", []uint8{0, 2, 4, 7}, []uint8{62, 64, 67, 72}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.symbol, func(t *testing.T) {
+			s, err := ParseSymbol(c.symbol)
+
+			assert := assert.New(t)
+			assert.Nil(err)
+			assert.Equal(c.pitchClasses, s.PitchClasses())
+			assert.Equal(c.notes, s.Notes())
+		})
+	}
+}
+
+func TestParseSymbolErrors(t *testing.T) {
+	for _, symbol := range []string{"", "H7", "Cxyz", "C/Q"} {
+		t.Run(symbol, func(t *testing.T) {
+			_, err := ParseSymbol(symbol)
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package chunk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+)
+
+var chunkFilenameRegex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\.dat$`)
+
+// temp files of chunkWriter and sortBucket
+var tempFilenameRegex = regexp.MustCompile(`^(chunkdata|run)-\d+\.tmp$`)
+
+func readCheckpoint() (model.ChunkCheckpoint, bool) {
+	if !util.Exists(util.GetChunkCheckpointPath()) {
+		return model.ChunkCheckpoint{}, false
+	}
+	return util.ReadBinaryOrPanic[model.ChunkCheckpoint](util.GetChunkCheckpointPath()), true
+}
+
+func writeCheckpoint(numBucketsDone int, chunks []model.ChunkOverview) {
+	var cp model.ChunkCheckpoint
+	cp.NumBucketsDone = numBucketsDone
+	cp.Chunks = chunks
+	util.ReplaceBinary(util.GetChunkCheckpointPath(), cp)
+}
+
+// DeleteCheckpoint forgets how far making chunks got so the next CreateAll
+// starts over
+func DeleteCheckpoint() {
+	os.Remove(util.GetChunkCheckpointPath())
+}
+
+// DeleteUnreferenced deletes the chunks that aren't in allChunks.dat, like
+// the delta chunks of an incremental index that crashed or chunks that were
+// replaced by compacting, and any temp files that were left behind
+func DeleteUnreferenced() {
+	deleteUncheckpointedChunks(model.ChunkCheckpoint{})
+}
+
+// deleteUncheckpointedChunks deletes the chunks that were made after the
+// checkpoint was written, leaving the ones the index already had alone, and
+// any temp files that were left behind
+func deleteUncheckpointedChunks(cp model.ChunkCheckpoint) {
+	checkpointed := make(map[string]bool)
+	for _, c := range cp.Chunks {
+		checkpointed[c.Filename] = true
+	}
+	if util.Exists(util.GetAllChunksPath()) {
+		for _, c := range util.ReadBinaryOrPanic[[]model.ChunkOverview](util.GetAllChunksPath()) {
+			checkpointed[c.Filename] = true
+		}
+	}
+
+	files, err := ioutil.ReadDir(util.GetIndexDir())
+	if err != nil {
+		panic("Could not read index dir because: " + err.Error())
+	}
+	for _, file := range files {
+		isUncheckpointed := chunkFilenameRegex.MatchString(file.Name()) && !checkpointed[file.Name()]
+		if isUncheckpointed || tempFilenameRegex.MatchString(file.Name()) {
+			os.Remove(filepath.Join(util.GetIndexDir(), file.Name()))
+		}
+	}
+}
@@ -1,47 +1,17 @@
 package chunk
 
 import (
-	"bytes"
-	"encoding/binary"
-	"encoding/gob"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"os"
 	"path/filepath"
-	"sort"
 
 	"github.com/google/uuid"
 	"github.com/jsphweid/harmondex/bucket"
-	"github.com/jsphweid/harmondex/chord"
 	"github.com/jsphweid/harmondex/constants"
 	"github.com/jsphweid/harmondex/model"
 	"github.com/jsphweid/harmondex/util"
 )
 
-type ChordKeyToChords = map[string][]model.Chord
-
-func getKeysSorted(m ChordKeyToChords) []string {
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
-	}
-	sort.Slice(keys, func(i, j int) bool {
-		return keys[i] < keys[j]
-	})
-	return keys
-}
-
-func getEncodedMapSize(m map[string]model.Pair) uint32 {
-	buf := new(bytes.Buffer)
-	encoder := gob.NewEncoder(buf)
-	err := encoder.Encode(m)
-	if err != nil {
-		panic("error getting map size: " + err.Error())
-	}
-	return uint32(len(buf.Bytes()))
-}
-
 func makeChunkOverview(sortedKeys []string) model.ChunkOverview {
 	var c model.ChunkOverview
 	c.Filename = uuid.New().String() + ".dat"
@@ -50,158 +20,98 @@ func makeChunkOverview(sortedKeys []string) model.ChunkOverview {
 	return c
 }
 
-func makeChunk(m ChordKeyToChords, sortedKeys []string) model.ChunkOverview {
-	c := makeChunkOverview(sortedKeys)
-	chunkIndex := make(model.ChunkIndex)
-	dataOffset := 0
-
-	// fill up data section
-	// NOTE: for now, chord instances have no ordering
-	dataBuf := new(bytes.Buffer)
-	for i, key := range sortedKeys {
-		chords := m[key]
-		chord.RankSortChords(chords)
-		p := chunkIndex[key]
-		p.Start = uint32(dataOffset)
-		chunkIndex[key] = p
-		// set End on the previous sortedKey in chunkIndex
-		if i > 0 {
-			pp := chunkIndex[sortedKeys[i-1]]
-			pp.End = uint32(dataOffset)
-			chunkIndex[sortedKeys[i-1]] = pp
-		}
-		for _, chord := range chords {
-			binary.Write(dataBuf, binary.LittleEndian, chord.AbsTickOffset)
-			binary.Write(dataBuf, binary.LittleEndian, chord.FileNum)
-			dataOffset += 8
-		}
-	}
-
-	// set End on the last sortedKey in chunkIndex
-	p := chunkIndex[sortedKeys[len(sortedKeys)-1]]
-	p.End = uint32(dataOffset)
-	chunkIndex[sortedKeys[len(sortedKeys)-1]] = p
-
-	// encode index into buffer
-	indexBuf := new(bytes.Buffer)
-	encoder := gob.NewEncoder(indexBuf)
-	err := encoder.Encode(chunkIndex)
-	if err != nil {
-		panic("error making chunk, couldn't encode to get size: " + err.Error())
-	}
-
-	// encode size to a buffer
-	sizeBuf := new(bytes.Buffer)
-	indexSize := getEncodedMapSize(chunkIndex)
-	binary.Write(sizeBuf, binary.LittleEndian, indexSize)
-
-	// combine everything together
-	var finalBytes []byte
-	finalBytes = append(finalBytes, sizeBuf.Bytes()...)
-	finalBytes = append(finalBytes, indexBuf.Bytes()...)
-	finalBytes = append(finalBytes, dataBuf.Bytes()...)
-
-	// save as a file
-	filename := filepath.Join(util.GetIndexDir(), c.Filename)
-	err = ioutil.WriteFile(filename, finalBytes, 0777)
-	if err != nil {
-		panic("Write failed for chunk file: " + err.Error())
+// Write saves a chunk file with the postings of every key, which are grouped
+// by file with each file's postings in offset order
+func Write(sortedKeys []string, keyToPostings map[string][]byte) model.ChunkOverview {
+	cw := newChunkWriter()
+	for _, key := range sortedKeys {
+		cw.write(key, keyToPostings[key])
 	}
-	return c
+	return cw.finish()
 }
 
-func maybeMakeChunks(m ChordKeyToChords, force bool) []model.ChunkOverview {
-	var size int
-	var currKeys []string
-
-	sortedKeys := getKeysSorted(m)
-	var createdChunks []model.ChunkOverview
-
-	for i, key := range sortedKeys {
-		currKeys = append(currKeys, key)
-		chords := m[key]
-
-		// each chord will take up uint32 and uint32 == 8 bytes
-		size += len(chords) * 8
-		// each index will take up some vari length + uint32 == 28 bytes?
-		// NOTE: note completely accurate because we're encoding a map when we write
-		size += len(key) + 4
-
-		isLast := len(sortedKeys)-1 == i
-		if size > constants.PreferredChunkSize || (isLast && force) {
-			chunk := makeChunk(m, currKeys)
-			createdChunks = append(createdChunks, chunk)
-			size = 0
-			for _, cKey := range currKeys {
-				delete(m, cKey)
-			}
-			currKeys = currKeys[:0]
+// makeChunks writes the postings to chunks, cutting a chunk once it's over
+// constants.PreferredChunkSize. The postings that are left over are returned
+// unless force, in which case they're made into a chunk too.
+func makeChunks(it postingIterator, force bool) ([]model.ChunkOverview, map[string][]byte) {
+	var res []model.ChunkOverview
+	cw := newChunkWriter()
+
+	kp, ok := it.next()
+	for ok {
+		key := kp.key
+		for ok && kp.key == key {
+			cw.write(key, kp.posting[:])
+			kp, ok = it.next()
+		}
+
+		// NOTE: chunks are only cut between keys
+		if cw.size > constants.PreferredChunkSize || (!ok && force) {
+			res = append(res, cw.finish())
+			cw = newChunkWriter()
 		}
 	}
 
-	return createdChunks
+	return res, cw.takePostings()
 }
 
 func getBucketPaths() []string {
-	outDir := util.GetIndexDir()
-	files, err := ioutil.ReadDir(outDir)
+	bucketDir := util.GetBucketDir()
+	files, err := ioutil.ReadDir(bucketDir)
 	if err != nil {
-		panic("Could not make chunks because out file not read:" + err.Error())
+		panic("Could not make chunks because bucket dir not read:" + err.Error())
 	}
 
 	var res []string
 	for _, file := range files {
-		res = append(res, filepath.Join(outDir, file.Name()))
+		if bucket.IsBucketFile(file.Name()) {
+			res = append(res, filepath.Join(bucketDir, file.Name()))
+		}
 	}
 	return res
 }
 
-func CreateAll() []model.ChunkOverview {
-	m := make(ChordKeyToChords)
-	var res []model.ChunkOverview
+// CreateAll makes chunks out of every bucket, keeping about memoryBudget
+// bytes of postings from buckets in memory (on top of the postings that
+// aren't in a chunk yet, which are less than constants.PreferredChunkSize).
+// Progress is checkpointed so if a previous call didn't finish, this picks
+// up after the last bucket it checkpointed.
+func CreateAll(memoryBudget int) []model.ChunkOverview {
+	cp, ok := readCheckpoint()
+	if ok {
+		deleteUncheckpointedChunks(cp)
+	} else {
+		writeCheckpoint(0, nil)
+	}
+	res := cp.Chunks
+	leftovers := make(map[string][]byte)
 
 	buckets := getBucketPaths()
-	for i, bucketPath := range buckets {
+	for i := cp.NumBucketsDone; i < len(buckets); i++ {
 		fmt.Printf("Processing %v of %v buckets\n", i+1, len(buckets))
-		for _, c := range bucket.ReadChords(bucketPath) {
-			chordKey := chord.CreateChordKey(c.Notes)
-			currChords := m[chordKey]
-			currChords = append(currChords, c)
-			m[chordKey] = currChords
-		}
 
-		// check at end of every bucket to see if we can make chunks
 		// we have to make chunks on bucket boundaries
 		// if last bucket, we have to make sure we make the rest...
+		// NOTE: everything is made into chunks before a checkpoint so
+		// resuming never has to go back to buckets before it
 		isLastBucket := len(buckets)-1 == i
-		res = append(res, maybeMakeChunks(m, isLastBucket)...)
+		isCheckpoint := isLastBucket || (i+1)%constants.BucketsPerCheckpoint == 0
+
+		// keys are never in more than one bucket so the leftovers can be
+		// merged in without mixing postings of a key
+		it := newMergeIterator([]postingIterator{
+			iterateLeftovers(leftovers),
+			sortBucket(buckets[i], memoryBudget),
+		})
+		var created []model.ChunkOverview
+		created, leftovers = makeChunks(it, isCheckpoint)
+		it.close()
+
+		res = append(res, created...)
+		if isCheckpoint {
+			writeCheckpoint(i+1, res)
+		}
 	}
 
 	return res
 }
-
-func ReadIndexOrPanic(f *os.File) (model.ChunkIndex, uint32) {
-	// reads the index and returns it, advancing file to end of index point
-
-	buf := make([]byte, 4)
-	_, err := io.ReadFull(f, buf)
-	if err != nil {
-		panic("Could not read first 4 bytes: " + err.Error())
-	}
-	indexLength := binary.LittleEndian.Uint32(buf)
-
-	buf = make([]byte, indexLength)
-	_, err = io.ReadFull(f, buf)
-	if err != nil {
-		panic("Could not read first 4 bytes: " + err.Error())
-	}
-
-	var index model.ChunkIndex
-	// NOTE: seems silly to have to do this
-	decoder := gob.NewDecoder(bytes.NewReader(buf))
-	err = decoder.Decode(&index)
-	if err != nil {
-		panic("Could not decode allChunks file: " + err.Error())
-	}
-	return index, indexLength
-}
@@ -0,0 +1,67 @@
+package chunk
+
+import (
+	"encoding/binary"
+	"io"
+	"path/filepath"
+
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+)
+
+// readChunk reads the index and the whole data section of a chunk
+func readChunk(filename string) (KeyTable, []byte) {
+	f := util.OpenFileOrPanic(filepath.Join(util.GetIndexDir(), filename))
+	defer f.Close()
+
+	t, _ := ReadKeyTableOrPanic(f)
+	data, err := io.ReadAll(f)
+	if err != nil {
+		panic("Could not read chunk data: " + err.Error())
+	}
+	return t, data
+}
+
+func removeDeletedPostings(postings []byte, deleted model.FileNumSet) []byte {
+	var res []byte
+	for i := 0; i < len(postings); i += constants.PostingSize {
+		posting := postings[i : i+constants.PostingSize]
+		if !deleted[binary.LittleEndian.Uint32(posting[4:8])] {
+			res = append(res, posting...)
+		}
+	}
+	return res
+}
+
+// Compact rewrites a chunk without the postings of deleted files. The chunk
+// is returned as is when none of its postings were deleted and false is
+// returned when nothing is left of it.
+func Compact(c model.ChunkOverview, deleted model.FileNumSet) (model.ChunkOverview, bool) {
+	t, data := readChunk(c.Filename)
+
+	changed := false
+	var sortedKeys []string
+	keyToPostings := make(map[string][]byte)
+	for i := 0; i < t.Len(); i++ {
+		key, p := t.Key(i), t.Entry(i)
+		decoded, err := DecodePostings(data[p.Start:p.End], 0)
+		if err != nil {
+			panic("Could not decode postings of " + key + ": " + err.Error())
+		}
+		postings := removeDeletedPostings(decoded, deleted)
+		changed = changed || len(postings) != len(decoded)
+		if len(postings) > 0 {
+			sortedKeys = append(sortedKeys, key)
+			keyToPostings[key] = postings
+		}
+	}
+
+	if !changed {
+		return c, true
+	}
+	if len(keyToPostings) == 0 {
+		return c, false
+	}
+	return Write(sortedKeys, keyToPostings), true
+}
@@ -0,0 +1,184 @@
+package chunk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+)
+
+// The index at the top of a chunk is a key table that's searched where it
+// is instead of being decoded. After the 4 byte length of the table:
+//
+//	header   number of keys (4), length of the key strings (4)
+//	entries  one per key, sorted by key (keyTableEntrySize each)
+//	keys     every key string, one after another
+//	blocks   every PostingBlock, start (4), first file (4) and prev file (4)
+//
+// An entry is the offset (4) and length (4) of its key in keys, the start
+// (4), end (4), number of files (4) and number of postings (4) of its
+// postings, and the index (4) of its first block in blocks and how many
+// blocks it has (4).
+const keyTableHeaderSize = 8
+const keyTableEntrySize = 32
+const keyTableBlockSize = 12
+
+type KeyTable struct {
+	b        []byte
+	numKeys  int
+	keysAt   int
+	blocksAt int
+}
+
+func u32(b []byte, at int) uint32 {
+	return binary.LittleEndian.Uint32(b[at : at+4])
+}
+
+// encodeKeyTable lays out the index of a chunk as a key table
+func encodeKeyTable(index model.ChunkIndex) []byte {
+	sortedKeys := util.GetKeys(index)
+	sort.Strings(sortedKeys)
+
+	var keysLen int
+	for _, key := range sortedKeys {
+		keysLen += len(key)
+	}
+
+	entries := new(bytes.Buffer)
+	keys := new(bytes.Buffer)
+	blocks := new(bytes.Buffer)
+	var numBlocks uint32
+	for _, key := range sortedKeys {
+		entry := index[key]
+		binary.Write(entries, binary.LittleEndian, []uint32{
+			uint32(keys.Len()), uint32(len(key)),
+			entry.Start, entry.End, entry.NumFiles, entry.NumPostings,
+			numBlocks, uint32(len(entry.Blocks)),
+		})
+		keys.WriteString(key)
+		for _, block := range entry.Blocks {
+			binary.Write(blocks, binary.LittleEndian, []uint32{block.Start, block.FirstFile, block.PrevFile})
+		}
+		numBlocks += uint32(len(entry.Blocks))
+	}
+
+	res := new(bytes.Buffer)
+	binary.Write(res, binary.LittleEndian, []uint32{uint32(len(sortedKeys)), uint32(keysLen)})
+	res.Write(entries.Bytes())
+	res.Write(keys.Bytes())
+	res.Write(blocks.Bytes())
+	return res.Bytes()
+}
+
+func decodeKeyTable(b []byte) (KeyTable, error) {
+	var t KeyTable
+	if len(b) < keyTableHeaderSize {
+		return t, fmt.Errorf("key table is only %v bytes", len(b))
+	}
+	t.b = b
+	t.numKeys = int(u32(b, 0))
+	t.keysAt = keyTableHeaderSize + t.numKeys*keyTableEntrySize
+	t.blocksAt = t.keysAt + int(u32(b, 4))
+	if t.blocksAt > len(b) || (len(b)-t.blocksAt)%keyTableBlockSize != 0 {
+		return t, fmt.Errorf("key table of %v keys doesn't fit in %v bytes", t.numKeys, len(b))
+	}
+	return t, nil
+}
+
+// ReadKeyTableOrPanic reads the index of the chunk, leaving the file at the
+// start of the data section, and returns it with its length
+func ReadKeyTableOrPanic(f *os.File) (KeyTable, uint32) {
+	buf := make([]byte, 4)
+	_, err := io.ReadFull(f, buf)
+	if err != nil {
+		panic("Could not read first 4 bytes: " + err.Error())
+	}
+	indexLength := binary.LittleEndian.Uint32(buf)
+
+	buf = make([]byte, indexLength)
+	_, err = io.ReadFull(f, buf)
+	if err != nil {
+		panic("Could not read chunk index: " + err.Error())
+	}
+
+	t, err := decodeKeyTable(buf)
+	if err != nil {
+		panic("Could not read chunk index: " + err.Error())
+	}
+	return t, indexLength
+}
+
+func (t KeyTable) Len() int {
+	return t.numKeys
+}
+
+// Size is the number of bytes of the table
+func (t KeyTable) Size() int {
+	return len(t.b)
+}
+
+func (t KeyTable) entryAt(i int) int {
+	return keyTableHeaderSize + i*keyTableEntrySize
+}
+
+func (t KeyTable) Key(i int) string {
+	at := t.entryAt(i)
+	start := t.keysAt + int(u32(t.b, at))
+	return string(t.b[start : start+int(u32(t.b, at+4))])
+}
+
+func (t KeyTable) Entry(i int) model.IndexEntry {
+	var res model.IndexEntry
+	at := t.entryAt(i)
+	res.Start = u32(t.b, at+8)
+	res.End = u32(t.b, at+12)
+	res.NumFiles = u32(t.b, at+16)
+	res.NumPostings = u32(t.b, at+20)
+	firstBlock := int(u32(t.b, at+24))
+	numBlocks := int(u32(t.b, at+28))
+	for j := firstBlock; j < firstBlock+numBlocks; j++ {
+		blockAt := t.blocksAt + j*keyTableBlockSize
+		res.Blocks = append(res.Blocks, model.PostingBlock{
+			Start:     u32(t.b, blockAt),
+			FirstFile: u32(t.b, blockAt+4),
+			PrevFile:  u32(t.b, blockAt+8),
+		})
+	}
+	return res
+}
+
+// Find binary searches for the entry of key, false if it's not in the chunk
+func (t KeyTable) Find(key string) (model.IndexEntry, bool) {
+	i := sort.Search(t.numKeys, func(i int) bool {
+		return t.Key(i) >= key
+	})
+	if i == t.numKeys || t.Key(i) != key {
+		return model.IndexEntry{}, false
+	}
+	return t.Entry(i), true
+}
+
+// validate checks that everything in the table points inside of it and the
+// keys are sorted, which Find depends on
+func (t KeyTable) validate() error {
+	keysLen := t.blocksAt - t.keysAt
+	numBlocks := (len(t.b) - t.blocksAt) / keyTableBlockSize
+	for i := 0; i < t.numKeys; i++ {
+		at := t.entryAt(i)
+		if int(u32(t.b, at))+int(u32(t.b, at+4)) > keysLen {
+			return fmt.Errorf("key %v is outside of the key strings", i)
+		}
+		if int(u32(t.b, at+24))+int(u32(t.b, at+28)) > numBlocks {
+			return fmt.Errorf("blocks of key %v are outside of the blocks", i)
+		}
+		if i > 0 && t.Key(i-1) >= t.Key(i) {
+			return fmt.Errorf("key %v comes after %v", t.Key(i-1), t.Key(i))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package chunk
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/jsphweid/harmondex/bucket"
+	"github.com/jsphweid/harmondex/chord"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+)
+
+// roughly how much memory a keyedPosting takes besides its key
+const keyedPostingOverhead = 48
+
+type keyedPosting struct {
+	key     string
+	posting [constants.PostingSize]byte
+
+	// best rank score of the postings of the key in the same file
+	fileRank uint8
+}
+
+func (kp *keyedPosting) fileNum() uint32 {
+	return binary.LittleEndian.Uint32(kp.posting[4:8])
+}
+
+func (kp *keyedPosting) rankScore() uint8 {
+	return kp.posting[14]
+}
+
+func (kp *keyedPosting) offset() uint32 {
+	return binary.LittleEndian.Uint32(kp.posting[0:4])
+}
+
+// comesBefore orders postings by key and then groups them by file, with the
+// files with the best ranked postings first and each file's in offset order
+func (kp *keyedPosting) comesBefore(other *keyedPosting) bool {
+	if kp.key != other.key {
+		return kp.key < other.key
+	}
+	if kp.fileRank != other.fileRank {
+		return kp.fileRank > other.fileRank
+	}
+	if kp.fileNum() != other.fileNum() {
+		return kp.fileNum() < other.fileNum()
+	}
+	return kp.offset() < other.offset()
+}
+
+// postingIterator goes through postings in comesBefore order
+type postingIterator interface {
+	// next returns false once there are no postings left
+	next() (keyedPosting, bool)
+	close()
+}
+
+type sliceIterator struct {
+	postings []keyedPosting
+}
+
+func (it *sliceIterator) next() (keyedPosting, bool) {
+	if len(it.postings) == 0 {
+		return keyedPosting{}, false
+	}
+	res := it.postings[0]
+	it.postings = it.postings[1:]
+	return res, true
+}
+
+func (it *sliceIterator) close() {}
+
+func sortKeyedPostings(postings []keyedPosting) {
+	// NOTE: stable so postings at the same offset stay in bucket order
+	sort.SliceStable(postings, func(i, j int) bool {
+		return postings[i].comesBefore(&postings[j])
+	})
+}
+
+// runIterator reads back a sorted run that was spilled to a temp file
+type runIterator struct {
+	f      *os.File
+	reader *bufio.Reader
+}
+
+func (it *runIterator) next() (keyedPosting, bool) {
+	var res keyedPosting
+	lenBuf := make([]byte, 2)
+	_, err := io.ReadFull(it.reader, lenBuf)
+	if err == io.EOF {
+		return res, false
+	}
+	if err != nil {
+		panic("Could not read run: " + err.Error())
+	}
+	keyBuf := make([]byte, binary.LittleEndian.Uint16(lenBuf))
+	if _, err := io.ReadFull(it.reader, keyBuf); err != nil {
+		panic("Could not read run: " + err.Error())
+	}
+	if _, err := io.ReadFull(it.reader, res.posting[:]); err != nil {
+		panic("Could not read run: " + err.Error())
+	}
+	res.fileRank, err = it.reader.ReadByte()
+	if err != nil {
+		panic("Could not read run: " + err.Error())
+	}
+	res.key = string(keyBuf)
+	return res, true
+}
+
+func (it *runIterator) close() {
+	it.f.Close()
+	os.Remove(it.f.Name())
+}
+
+// spillRun sorts postings and writes them to a temp file
+func spillRun(postings []keyedPosting) postingIterator {
+	sortKeyedPostings(postings)
+
+	f, err := ioutil.TempFile(util.GetIndexDir(), "run-*.tmp")
+	if err != nil {
+		panic("Could not create run file: " + err.Error())
+	}
+	writer := bufio.NewWriterSize(f, writerBufferSize)
+	lenBuf := make([]byte, 2)
+	for _, kp := range postings {
+		binary.LittleEndian.PutUint16(lenBuf, uint16(len(kp.key)))
+		writer.Write(lenBuf)
+		writer.WriteString(kp.key)
+		writer.Write(kp.posting[:])
+		writer.WriteByte(kp.fileRank)
+	}
+	if err := writer.Flush(); err != nil {
+		panic("Could not write run file: " + err.Error())
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		panic("Could not read run file: " + err.Error())
+	}
+	return &runIterator{f, bufio.NewReaderSize(f, writerBufferSize)}
+}
+
+type mergeHead struct {
+	posting keyedPosting
+	source  int
+}
+
+type mergeHeap []mergeHead
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].posting.comesBefore(&h[j].posting) {
+		return true
+	}
+	if h[j].posting.comesBefore(&h[i].posting) {
+		return false
+	}
+	// earlier sources first so ties stay in bucket order
+	return h[i].source < h[j].source
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(mergeHead)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	res := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return res
+}
+
+// mergeIterator merges sorted iterators into one
+type mergeIterator struct {
+	sources []postingIterator
+	heads   mergeHeap
+}
+
+func newMergeIterator(sources []postingIterator) *mergeIterator {
+	it := &mergeIterator{sources: sources}
+	for i, source := range sources {
+		if kp, ok := source.next(); ok {
+			it.heads = append(it.heads, mergeHead{kp, i})
+		}
+	}
+	heap.Init(&it.heads)
+	return it
+}
+
+func (it *mergeIterator) next() (keyedPosting, bool) {
+	if len(it.heads) == 0 {
+		return keyedPosting{}, false
+	}
+	head := it.heads[0]
+	if kp, ok := it.sources[head.source].next(); ok {
+		it.heads[0].posting = kp
+		heap.Fix(&it.heads, 0)
+	} else {
+		heap.Pop(&it.heads)
+	}
+	return head.posting, true
+}
+
+func (it *mergeIterator) close() {
+	for _, source := range it.sources {
+		source.close()
+	}
+}
+
+// iterateLeftovers goes through postings that weren't made into a chunk yet
+func iterateLeftovers(keyToPostings map[string][]byte) postingIterator {
+	var res []keyedPosting
+	for key, postings := range keyToPostings {
+		for i := 0; i < len(postings); i += constants.PostingSize {
+			var kp keyedPosting
+			kp.key = key
+			copy(kp.posting[:], postings[i:i+constants.PostingSize])
+			res = append(res, kp)
+		}
+	}
+	// NOTE: postings of a key are already in order and without their
+	// fileRank they can't be put back in order anyway
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].key < res[j].key
+	})
+	return &sliceIterator{res}
+}
+
+func encodePosting(c model.Chord) [constants.PostingSize]byte {
+	var res [constants.PostingSize]byte
+	binary.LittleEndian.PutUint32(res[0:4], c.AbsTickOffset)
+	binary.LittleEndian.PutUint32(res[4:8], c.FileNum)
+	binary.LittleEndian.PutUint32(res[8:12], c.SeqNum)
+	res[12] = c.Notes[0]
+	res[13] = chord.SerializeFlags(c)
+	res[14] = chord.GetRankScore(c)
+	return res
+}
+
+// setFileRanks sets the fileRank of postings, which are all from one file
+func setFileRanks(postings []keyedPosting) {
+	keyToBest := make(map[string]uint8)
+	for _, kp := range postings {
+		if kp.rankScore() > keyToBest[kp.key] {
+			keyToBest[kp.key] = kp.rankScore()
+		}
+	}
+	for i := range postings {
+		postings[i].fileRank = keyToBest[postings[i].key]
+	}
+}
+
+// sortBucket goes through the postings of every chord in the bucket at path
+// in order without holding more than about memoryBudget bytes of them in
+// memory at once, by sorting runs of them and spilling those to temp files
+func sortBucket(path string, memoryBudget int) postingIterator {
+	createChordKey := bucket.GetChordKeyFunc(path)
+	var runs []postingIterator
+	var postings []keyedPosting
+	var size int
+
+	// NOTE: files are written to buckets one at a time so the chords of
+	// a file are all together, and runs are only cut between files
+	var filePostings []keyedPosting
+	endFile := func() {
+		setFileRanks(filePostings)
+		postings = append(postings, filePostings...)
+		filePostings = filePostings[:0]
+		if size > memoryBudget {
+			runs = append(runs, spillRun(postings))
+			postings = nil
+			size = 0
+		}
+	}
+
+	bucket.ForEachChord(path, func(c model.Chord) {
+		if len(filePostings) > 0 && filePostings[0].fileNum() != c.FileNum {
+			endFile()
+		}
+		// NOTE: key funcs sort notes so notes[0] is the lowest afterwards
+		kp := keyedPosting{key: createChordKey(c.Notes)}
+		kp.posting = encodePosting(c)
+		filePostings = append(filePostings, kp)
+		size += len(kp.key) + keyedPostingOverhead
+	})
+	endFile()
+
+	sortKeyedPostings(postings)
+	if len(runs) == 0 {
+		return &sliceIterator{postings}
+	}
+	return newMergeIterator(append(runs, &sliceIterator{postings}))
+}
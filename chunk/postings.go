@@ -0,0 +1,154 @@
+package chunk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jsphweid/harmondex/chord"
+	"github.com/jsphweid/harmondex/constants"
+)
+
+// Postings are compressed in chunks a file at a time. A file's postings are
+// the difference between its num and the num of the file before it (varint),
+// how many postings it has (uvarint) and then every posting in offset order:
+// the difference from the offset (uvarint) and seq num (varint) of the
+// posting before it in the file, the lowest note and the flags. The rank
+// score isn't stored since it comes from the flags.
+
+var errTruncatedPostings = errors.New("postings end in the middle of a file")
+
+func putUvarint(dst []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(dst, buf[:binary.PutUvarint(buf[:], x)]...)
+}
+
+func putVarint(dst []byte, x int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(dst, buf[:binary.PutVarint(buf[:], x)]...)
+}
+
+// encodeFile appends the compressed postings of a file to dst. postings are
+// PostingSize postings of fileNum sorted by offset.
+func encodeFile(dst []byte, prevFile uint32, fileNum uint32, postings []byte) []byte {
+	dst = putVarint(dst, int64(fileNum)-int64(prevFile))
+	dst = putUvarint(dst, uint64(len(postings)/constants.PostingSize))
+	var prevOffset, prevSeqNum uint32
+	for i := 0; i < len(postings); i += constants.PostingSize {
+		offset := binary.LittleEndian.Uint32(postings[i : i+4])
+		seqNum := binary.LittleEndian.Uint32(postings[i+8 : i+12])
+		if offset < prevOffset {
+			panic(fmt.Sprintf("Postings of file %v have to be sorted by offset", fileNum))
+		}
+		dst = putUvarint(dst, uint64(offset-prevOffset))
+		dst = putVarint(dst, int64(seqNum)-int64(prevSeqNum))
+		dst = append(dst, postings[i+12], postings[i+13])
+		prevOffset, prevSeqNum = offset, seqNum
+	}
+	return dst
+}
+
+// postingReader reads compressed postings without panicking on bad ones
+type postingReader struct {
+	b   []byte
+	at  int
+	err error
+}
+
+func (r *postingReader) uvarint() uint64 {
+	x, n := binary.Uvarint(r.b[r.at:])
+	if n <= 0 {
+		r.err = errTruncatedPostings
+		r.at = len(r.b)
+		return 0
+	}
+	r.at += n
+	return x
+}
+
+func (r *postingReader) varint() int64 {
+	x, n := binary.Varint(r.b[r.at:])
+	if n <= 0 {
+		r.err = errTruncatedPostings
+		r.at = len(r.b)
+		return 0
+	}
+	r.at += n
+	return x
+}
+
+func (r *postingReader) byte() uint8 {
+	if r.at >= len(r.b) {
+		r.err = errTruncatedPostings
+		return 0
+	}
+	r.at += 1
+	return r.b[r.at-1]
+}
+
+// forEachFile decodes compressed postings, calling fn with where each file
+// starts in b, its num and its postings as PostingSize postings. prevFile is
+// the num of the file before the first one in b.
+func forEachFile(b []byte, prevFile uint32, fn func(at int, fileNum uint32, postings []byte)) error {
+	r := postingReader{b: b}
+	for r.at < len(b) {
+		start := r.at
+		fileNum := uint32(int64(prevFile) + r.varint())
+		numPostings := r.uvarint()
+		if numPostings > uint64(len(b)) {
+			return fmt.Errorf("file %v at %v has %v postings in %v bytes", fileNum, start, numPostings, len(b))
+		}
+
+		postings := make([]byte, numPostings*constants.PostingSize)
+		var offset, seqNum uint32
+		for i := 0; i < len(postings); i += constants.PostingSize {
+			offset += uint32(r.uvarint())
+			seqNum = uint32(int64(seqNum) + r.varint())
+			binary.LittleEndian.PutUint32(postings[i:i+4], offset)
+			binary.LittleEndian.PutUint32(postings[i+4:i+8], fileNum)
+			binary.LittleEndian.PutUint32(postings[i+8:i+12], seqNum)
+			postings[i+12] = r.byte()
+			postings[i+13] = r.byte()
+			postings[i+14] = chord.GetFlagsRankScore(postings[i+13])
+		}
+		if r.err != nil {
+			return r.err
+		}
+		fn(start, fileNum, postings)
+		prevFile = fileNum
+	}
+	return nil
+}
+
+// ForEachFileSize goes through compressed postings like forEachFile but
+// only calls fn with the num of each file and how many postings it has
+func ForEachFileSize(b []byte, prevFile uint32, fn func(fileNum uint32, numPostings int)) error {
+	r := postingReader{b: b}
+	for r.at < len(b) {
+		fileNum := uint32(int64(prevFile) + r.varint())
+		numPostings := r.uvarint()
+		for i := uint64(0); i < numPostings && r.err == nil; i++ {
+			r.uvarint()
+			r.varint()
+			r.byte()
+			r.byte()
+		}
+		if r.err != nil {
+			return r.err
+		}
+		fn(fileNum, int(numPostings))
+		prevFile = fileNum
+	}
+	return nil
+}
+
+// DecodePostings turns compressed postings from a chunk back into
+// PostingSize postings. prevFile is the PrevFile of the block b starts with
+// or 0 when it starts with the first file of a key.
+func DecodePostings(b []byte, prevFile uint32) ([]byte, error) {
+	var res []byte
+	err := forEachFile(b, prevFile, func(at int, fileNum uint32, postings []byte) {
+		res = append(res, postings...)
+	})
+	return res, err
+}
@@ -0,0 +1,50 @@
+package chunk
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/jsphweid/harmondex/chord"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func makePosting(c model.Chord) []byte {
+	res := encodePosting(c)
+	return res[:]
+}
+
+func TestCompressesPostingsAndDecodesThemBack(t *testing.T) {
+	assert := assert.New(t)
+
+	// files aren't in num order since better ranked files come first, and
+	// seq nums don't always go up with offsets
+	var raw []byte
+	var encoded []byte
+	var prevFile uint32
+	for _, fileNum := range []uint32{900, 12, 4000000000} {
+		var postings []byte
+		postings = append(postings, makePosting(model.Chord{AbsTickOffset: 0, FileNum: fileNum, SeqNum: 5, Notes: []uint8{40}})...)
+		postings = append(postings, makePosting(model.Chord{AbsTickOffset: 480, FileNum: fileNum, SeqNum: 3, Notes: []uint8{60}, FormedByNoteOn: true})...)
+		postings = append(postings, makePosting(model.Chord{AbsTickOffset: 4000000000, FileNum: fileNum, SeqNum: 4000000000, Notes: []uint8{127}, FileHasMetadata: true, OldestEventWithin1Sec: true})...)
+		raw = append(raw, postings...)
+		encoded = encodeFile(encoded, prevFile, fileNum, postings)
+		prevFile = fileNum
+	}
+
+	decoded, err := DecodePostings(encoded, 0)
+	assert.Nil(err)
+	assert.Equal(raw, decoded)
+	assert.Equal(chord.GetFlagsRankScore(decoded[constants.PostingSize+13]), uint8(3))
+
+	var fileNums []uint32
+	forEachFile(encoded, 0, func(at int, fileNum uint32, postings []byte) {
+		fileNums = append(fileNums, fileNum)
+		assert.Equal(fileNum, binary.LittleEndian.Uint32(postings[4:8]))
+	})
+	assert.Equal([]uint32{900, 12, 4000000000}, fileNums)
+
+	_, err = DecodePostings(encoded[:len(encoded)-1], 0)
+	assert.NotNil(err)
+}
@@ -0,0 +1,103 @@
+package chunk
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+)
+
+func readIndexOrError(filename string) (t KeyTable, data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	f := util.OpenFileOrPanic(filepath.Join(util.GetIndexDir(), filename))
+	defer f.Close()
+	t, _ = ReadKeyTableOrPanic(f)
+	if err := t.validate(); err != nil {
+		return t, nil, err
+	}
+	data, err = io.ReadAll(f)
+	return t, data, err
+}
+
+// Verify checks that the chunk file is intact and agrees with its overview
+// and the file map, returning everything that's wrong with it
+func Verify(c model.ChunkOverview, fileNumMap model.FileNumToMidiPath) []error {
+	var res []error
+	fail := func(format string, a ...any) {
+		res = append(res, fmt.Errorf(c.Filename+": "+format, a...))
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(util.GetIndexDir(), c.Filename))
+	if err != nil {
+		fail("could not read: %v", err)
+		return res
+	}
+	if checksum := crc32.ChecksumIEEE(b); checksum != c.Checksum {
+		fail("checksum is %08x but %08x was recorded", checksum, c.Checksum)
+	}
+
+	t, data, err := readIndexOrError(c.Filename)
+	if err != nil {
+		fail("could not parse index: %v", err)
+		return res
+	}
+
+	if t.Len() == 0 {
+		fail("index is empty")
+		return res
+	}
+	first, last := t.Key(0), t.Key(t.Len()-1)
+	if first != c.Start || last != c.End {
+		fail("keys go from %v to %v but overview says %v to %v", first, last, c.Start, c.End)
+	}
+
+	for k := 0; k < t.Len(); k++ {
+		key, p := t.Key(k), t.Entry(k)
+		if p.Start > p.End || int(p.End) > len(data) {
+			fail("postings of %v at %v-%v are outside of the %v byte data section", key, p.Start, p.End, len(data))
+			continue
+		}
+
+		blockStarts := make(map[uint32]model.PostingBlock)
+		for _, block := range p.Blocks {
+			blockStarts[block.Start] = block
+		}
+		var numFiles, numPostings, prevFile uint32
+		err := forEachFile(data[p.Start:p.End], 0, func(at int, fileNum uint32, postings []byte) {
+			if _, ok := fileNumMap[fileNum]; !ok {
+				fail("postings of %v at %v have unknown file num %v", key, p.Start+uint32(at), fileNum)
+			}
+			if block, ok := blockStarts[p.Start+uint32(at)]; ok {
+				if block.FirstFile != numFiles || block.PrevFile != prevFile {
+					fail("block of %v at %v doesn't start with file %v after %v", key, block.Start, block.FirstFile, block.PrevFile)
+				}
+				delete(blockStarts, block.Start)
+			}
+			numFiles += 1
+			numPostings += uint32(len(postings) / constants.PostingSize)
+			prevFile = fileNum
+		})
+		if err != nil {
+			fail("postings of %v at %v-%v can't be decoded: %v", key, p.Start, p.End, err)
+			continue
+		}
+		if numFiles != p.NumFiles || numPostings != p.NumPostings {
+			fail("%v has %v postings of %v files but its entry says %v of %v", key, numPostings, numFiles, p.NumPostings, p.NumFiles)
+		}
+		if len(blockStarts) > 0 {
+			fail("%v has %v blocks that don't start at a file", key, len(blockStarts))
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,191 @@
+package chunk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+)
+
+const writerBufferSize = 64 * 1024
+
+// chunkWriter writes a chunk a posting at a time. The data section goes to a
+// temp file until the chunk is finished so posting lists don't have to fit
+// in memory.
+type chunkWriter struct {
+	index   model.ChunkIndex
+	lastKey string
+	dataLen uint32
+
+	// postings of the last file written to, which are compressed once all
+	// of them are written
+	filePostings []byte
+	fileNum      uint32
+
+	// num of the last file of lastKey that was compressed
+	prevFile uint32
+
+	// estimated size of the chunk, its keys with their key table entries and
+	// the postings compressed so far
+	size int
+
+	data   *os.File
+	writer *bufio.Writer
+}
+
+func newChunkWriter() *chunkWriter {
+	f, err := ioutil.TempFile(util.GetIndexDir(), "chunkdata-*.tmp")
+	if err != nil {
+		panic("Could not create chunk data file: " + err.Error())
+	}
+	return &chunkWriter{
+		index:  make(model.ChunkIndex),
+		data:   f,
+		writer: bufio.NewWriterSize(f, writerBufferSize),
+	}
+}
+
+// write adds postings to key, which has to be the last key written to or
+// one that hasn't been written to yet. The postings of a file have to be
+// written one after another, sorted by offset.
+func (cw *chunkWriter) write(key string, postings []byte) {
+	if key != cw.lastKey {
+		if _, ok := cw.index[key]; ok {
+			panic("Postings of " + key + " have to be written all at once")
+		}
+		cw.endFile()
+		cw.index[key] = model.IndexEntry{Pair: model.Pair{Start: cw.dataLen, End: cw.dataLen}}
+		cw.size += len(key) + keyTableEntrySize
+		cw.lastKey = key
+		cw.prevFile = 0
+	}
+
+	for i := 0; i < len(postings); i += constants.PostingSize {
+		fileNum := binary.LittleEndian.Uint32(postings[i+4 : i+8])
+		if len(cw.filePostings) > 0 && fileNum != cw.fileNum {
+			cw.endFile()
+		}
+		cw.fileNum = fileNum
+		cw.filePostings = append(cw.filePostings, postings[i:i+constants.PostingSize]...)
+	}
+}
+
+// endFile compresses the postings of the last file written to
+func (cw *chunkWriter) endFile() {
+	if len(cw.filePostings) == 0 {
+		return
+	}
+	entry := cw.index[cw.lastKey]
+	cw.maybeStartBlock(&entry)
+
+	encoded := encodeFile(nil, cw.prevFile, cw.fileNum, cw.filePostings)
+	if _, err := cw.writer.Write(encoded); err != nil {
+		panic("Could not write chunk data: " + err.Error())
+	}
+	entry.End += uint32(len(encoded))
+	entry.NumFiles += 1
+	entry.NumPostings += uint32(len(cw.filePostings) / constants.PostingSize)
+	cw.index[cw.lastKey] = entry
+
+	cw.dataLen += uint32(len(encoded))
+	cw.size += len(encoded)
+	cw.prevFile = cw.fileNum
+	cw.filePostings = cw.filePostings[:0]
+}
+
+// maybeStartBlock starts a new block at the end of the entry if the last
+// one is big enough, which has to be called right before a new file
+func (cw *chunkWriter) maybeStartBlock(entry *model.IndexEntry) {
+	blockStart := entry.Start
+	if len(entry.Blocks) > 0 {
+		blockStart = entry.Blocks[len(entry.Blocks)-1].Start
+	}
+	if entry.End-blockStart < constants.PostingBlockSize {
+		return
+	}
+
+	if len(entry.Blocks) == 0 {
+		entry.Blocks = append(entry.Blocks, model.PostingBlock{Start: entry.Start})
+	}
+	entry.Blocks = append(entry.Blocks, model.PostingBlock{
+		Start:     entry.End,
+		FirstFile: entry.NumFiles,
+		PrevFile:  cw.prevFile,
+	})
+}
+
+func (cw *chunkWriter) isEmpty() bool {
+	return len(cw.index) == 0
+}
+
+func (cw *chunkWriter) discard() {
+	cw.data.Close()
+	os.Remove(cw.data.Name())
+}
+
+// finish saves the chunk file and returns its overview
+func (cw *chunkWriter) finish() model.ChunkOverview {
+	defer cw.discard()
+	cw.endFile()
+	if err := cw.writer.Flush(); err != nil {
+		panic("Could not write chunk data: " + err.Error())
+	}
+
+	sortedKeys := util.GetKeys(cw.index)
+	sort.Strings(sortedKeys)
+	c := makeChunkOverview(sortedKeys)
+
+	indexBytes := encodeKeyTable(cw.index)
+	sizeBuf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sizeBuf, uint32(len(indexBytes)))
+
+	// combine everything together while saving as a file
+	f, err := os.Create(filepath.Join(util.GetIndexDir(), c.Filename))
+	if err != nil {
+		panic("Write failed for chunk file: " + err.Error())
+	}
+	defer f.Close()
+	checksum := crc32.NewIEEE()
+	out := io.MultiWriter(f, checksum)
+	if _, err := cw.data.Seek(0, io.SeekStart); err != nil {
+		panic("Could not read chunk data: " + err.Error())
+	}
+	chunkBytes := io.MultiReader(bytes.NewReader(sizeBuf), bytes.NewReader(indexBytes), cw.data)
+	if _, err := io.Copy(out, chunkBytes); err != nil {
+		panic("Write failed for chunk file: " + err.Error())
+	}
+	c.Checksum = checksum.Sum32()
+	return c
+}
+
+// takePostings gives back every key's postings instead of making a chunk
+func (cw *chunkWriter) takePostings() map[string][]byte {
+	defer cw.discard()
+	cw.endFile()
+	if err := cw.writer.Flush(); err != nil {
+		panic("Could not write chunk data: " + err.Error())
+	}
+
+	data, err := ioutil.ReadFile(cw.data.Name())
+	if err != nil {
+		panic("Could not read chunk data: " + err.Error())
+	}
+	res := make(map[string][]byte)
+	for key, p := range cw.index {
+		postings, err := DecodePostings(data[p.Start:p.End], 0)
+		if err != nil {
+			panic("Could not decode chunk data: " + err.Error())
+		}
+		res[key] = postings
+	}
+	return res
+}
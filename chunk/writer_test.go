@@ -0,0 +1,116 @@
+package chunk
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// makePostings makes postingsPerFile postings for each of numFiles files
+func makePostings(numFiles int, postingsPerFile int) []byte {
+	var res []byte
+	for fileNum := 1; fileNum <= numFiles; fileNum++ {
+		for i := 0; i < postingsPerFile; i++ {
+			posting := make([]byte, constants.PostingSize)
+			binary.LittleEndian.PutUint32(posting[0:4], uint32(i))
+			binary.LittleEndian.PutUint32(posting[4:8], uint32(fileNum))
+			posting[12] = 60
+			res = append(res, posting...)
+		}
+	}
+	return res
+}
+
+func TestSplitsBigPostingListsIntoBlocksOfWholeFiles(t *testing.T) {
+	os.Setenv("INDEX_PATH", t.TempDir())
+	assert := assert.New(t)
+
+	// a file of 3 postings compresses to 14 bytes, which doesn't divide the
+	// block size evenly
+	fileSize := 14
+	numFiles := 15000
+	hot := makePostings(numFiles, 3)
+	c := Write([]string{"60-64-67", "60-65-69"}, map[string][]byte{
+		"60-64-67": hot,
+		"60-65-69": makePostings(2, 1),
+	})
+
+	f := util.OpenFileOrPanic(filepath.Join(util.GetIndexDir(), c.Filename))
+	kt, indexLength := ReadKeyTableOrPanic(f)
+	data, err := io.ReadAll(f)
+	f.Close()
+	assert.Nil(err)
+
+	small, ok := kt.Find("60-65-69")
+	assert.True(ok)
+	assert.Equal(uint32(2), small.NumFiles)
+	assert.Equal(uint32(2), small.NumPostings)
+	assert.Empty(small.Blocks)
+
+	entry, ok := kt.Find("60-64-67")
+	assert.True(ok)
+	assert.Equal(uint32(numFiles), entry.NumFiles)
+	assert.Equal(uint32(numFiles*3), entry.NumPostings)
+	assert.Equal(uint32(numFiles*fileSize), entry.End-entry.Start)
+	assert.Less(int(entry.End+indexLength), len(hot))
+	assert.Equal(4, len(entry.Blocks))
+	assert.Equal(model.PostingBlock{Start: entry.Start, FirstFile: 0, PrevFile: 0}, entry.Blocks[0])
+
+	// blocks are a little over the block size since they end with a whole
+	// file, and each one can be decoded on its own
+	firstFile := (constants.PostingBlockSize + fileSize - 1) / fileSize
+	assert.Equal(uint32(firstFile), entry.Blocks[1].FirstFile)
+	for i, block := range entry.Blocks {
+		assert.Equal(entry.Start+block.FirstFile*uint32(fileSize), block.Start)
+		assert.Equal(block.FirstFile, block.PrevFile)
+
+		end, lastFile := entry.End, uint32(numFiles)
+		if i+1 < len(entry.Blocks) {
+			end, lastFile = entry.Blocks[i+1].Start, entry.Blocks[i+1].FirstFile
+		}
+		postings, err := DecodePostings(data[block.Start:end], block.PrevFile)
+		assert.Nil(err)
+		assert.Equal(hot[block.FirstFile*3*constants.PostingSize:lastFile*3*constants.PostingSize], postings)
+	}
+
+	fileNumMap := make(model.FileNumToMidiPath)
+	for i := 1; i <= numFiles; i++ {
+		fileNumMap[uint32(i)] = "song.mid"
+	}
+	assert.Empty(Verify(c, fileNumMap))
+}
+
+func TestFindsKeysInTheKeyTable(t *testing.T) {
+	assert := assert.New(t)
+	index := model.ChunkIndex{
+		"60-64-67": {Pair: model.Pair{Start: 0, End: 30}, NumFiles: 2},
+		"p:0-4-7":  {Pair: model.Pair{Start: 30, End: 45}, NumFiles: 1},
+		"t:0-4-7": {Pair: model.Pair{Start: 45, End: 90}, NumFiles: 3, NumPostings: 4, Blocks: []model.PostingBlock{
+			{Start: 45, FirstFile: 0, PrevFile: 0},
+			{Start: 75, FirstFile: 2, PrevFile: 7},
+		}},
+	}
+	kt, err := decodeKeyTable(encodeKeyTable(index))
+	assert.Nil(err)
+	assert.Nil(kt.validate())
+	assert.Equal(3, kt.Len())
+	assert.Equal("60-64-67", kt.Key(0))
+	assert.Equal("t:0-4-7", kt.Key(2))
+
+	for key, expected := range index {
+		entry, ok := kt.Find(key)
+		assert.True(ok)
+		assert.Equal(expected, entry)
+	}
+	for _, key := range []string{"", "60-64", "60-64-68", "p:0-4-7-", "z"} {
+		_, ok := kt.Find(key)
+		assert.False(ok, key)
+	}
+}
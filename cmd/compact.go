@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jsphweid/harmondex/chunk"
+	"github.com/jsphweid/harmondex/dictionary"
+	"github.com/jsphweid/harmondex/file"
+	"github.com/jsphweid/harmondex/manifest"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(compactCmd)
+}
+
+var compactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Rewrites chunks without removed midi files",
+	Long:  `Rewrites chunks without removed midi files`,
+	Run: func(cmd *cobra.Command, args []string) {
+		Compact()
+	},
+}
+
+// Compact rewrites the chunks that have postings of removed files and
+// forgets about the removed files besides their paths and content. The
+// chunks that were rewritten are only deleted by the next Compact (or
+// IndexIncremental) since a running server can still be using them until
+// it reloads the index.
+func Compact() {
+	m := manifest.ReadOrPanic()
+	chunk.DeleteUnreferenced()
+	deleted := file.ReadDeletedFiles()
+	if len(deleted) == 0 {
+		fmt.Println("No removed midi files to compact")
+		return
+	}
+
+	oldChunks := util.ReadBinaryOrPanic[[]model.ChunkOverview](util.GetAllChunksPath())
+	var chunks []model.ChunkOverview
+	for i, c := range oldChunks {
+		fmt.Printf("Compacting %v of %v chunks\n", i+1, len(oldChunks))
+		compacted, ok := chunk.Compact(c, deleted)
+		if ok {
+			chunks = append(chunks, compacted)
+		}
+	}
+
+	fileNumMap := util.ReadBinaryOrPanic[model.FileNumToMidiPath](util.GetFileNumToNamePath())
+	files := readIndexedFiles()
+	deletedPaths := make(map[string]bool)
+	for num := range deleted {
+		deletedPaths[fileNumMap[num]] = true
+		delete(fileNumMap, num)
+		delete(files.Keys, num)
+		delete(files.AlternatePaths, num)
+	}
+	for hash, num := range files.Hashes {
+		if deleted[num] {
+			delete(files.Hashes, hash)
+		}
+	}
+	for num, paths := range files.AlternatePaths {
+		var kept []string
+		for _, path := range paths {
+			if !deletedPaths[path] {
+				kept = append(kept, path)
+			}
+		}
+		if len(kept) > 0 {
+			files.AlternatePaths[num] = kept
+		} else {
+			delete(files.AlternatePaths, num)
+		}
+	}
+
+	dictionary.Write(chunks)
+	util.ReplaceBinary(util.GetAllChunksPath(), chunks)
+	util.CreateBinary(util.GetFileNumToNamePath(), fileNumMap)
+	writeIndexedFiles(files)
+	m.NumFiles = len(fileNumMap)
+	m.Generation += 1
+	manifest.Write(m)
+	err := os.Remove(util.GetDeletedFilesPath())
+	if err != nil {
+		panic("Could not delete removed files list: " + err.Error())
+	}
+}
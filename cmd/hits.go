@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/jsphweid/harmondex/model"
+)
+
+var flagParamToGetter = map[string]func(hit model.RawResult) bool{
+	"file_has_metadata":         func(hit model.RawResult) bool { return hit.FileHasMetadata },
+	"formed_by_note_on":         func(hit model.RawResult) bool { return hit.FormedByNoteOn },
+	"oldest_event_within_1_sec": func(hit model.RawResult) bool { return hit.OldestEventWithin1Sec },
+}
+
+// hasHitFilters is whether the query params ask filterHits to drop anything
+func hasHitFilters(query url.Values) bool {
+	for param := range flagParamToGetter {
+		if query.Has(param) {
+			return true
+		}
+	}
+	return query.Has("min_rank_score")
+}
+
+// filterHits drops matches that don't have the flags or min_rank_score asked
+// for in the query params, like formed_by_note_on=true
+func filterHits(matches []model.RawResult, query url.Values) ([]model.RawResult, error) {
+	flagParamToValue := make(map[string]bool)
+	for param := range flagParamToGetter {
+		if !query.Has(param) {
+			continue
+		}
+		val, err := strconv.ParseBool(query.Get(param))
+		if err != nil {
+			return matches, errors.New("Could not parse " + param + ": " + err.Error())
+		}
+		flagParamToValue[param] = val
+	}
+
+	var minRankScore uint64
+	if query.Has("min_rank_score") {
+		val, err := strconv.ParseUint(query.Get("min_rank_score"), 10, 8)
+		if err != nil {
+			return matches, errors.New("Could not parse min_rank_score: " + err.Error())
+		}
+		minRankScore = val
+	}
+
+	if len(flagParamToValue) == 0 && minRankScore == 0 {
+		return matches, nil
+	}
+
+	var res []model.RawResult
+	for _, match := range matches {
+		keep := uint64(match.RankScore) >= minRankScore
+		for param, val := range flagParamToValue {
+			keep = keep && flagParamToGetter[param](match) == val
+		}
+		if keep {
+			res = append(res, match)
+		}
+	}
+	return res, nil
+}
+
+func explainHit(hit model.RawResult) model.HitExplanation {
+	return model.HitExplanation{
+		RankScore:             hit.RankScore,
+		FileHasMetadata:       hit.FileHasMetadata,
+		FormedByNoteOn:        hit.FormedByNoteOn,
+		OldestEventWithin1Sec: hit.OldestEventWithin1Sec,
+	}
+}
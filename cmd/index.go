@@ -1,16 +1,34 @@
 package cmd
 
 import (
+	"fmt"
+	"runtime"
 	"strconv"
 
 	"github.com/jsphweid/harmondex/bucket"
 	"github.com/jsphweid/harmondex/chunk"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/dictionary"
 	"github.com/jsphweid/harmondex/file"
+	"github.com/jsphweid/harmondex/manifest"
+	"github.com/jsphweid/harmondex/model"
 	"github.com/jsphweid/harmondex/util"
 	"github.com/spf13/cobra"
 )
 
+var numIndexWorkers int
+var incremental bool
+var resume bool
+var dedupNotes bool
+var chunkMemoryMB int
+
 func init() {
+	indexCmd.Flags().IntVar(&numIndexWorkers, "workers", runtime.NumCPU(), "number of midi files to process at once")
+	indexCmd.Flags().BoolVar(&incremental, "incremental", false, "only index midi files that aren't in the index yet")
+	indexCmd.Flags().BoolVar(&resume, "resume", false, "continue an index that didn't finish building")
+	indexCmd.Flags().BoolVar(&dedupNotes, "dedup-notes", false, "also skip midi files with the same notes as one that's indexed, not just the same bytes")
+	indexCmd.Flags().IntVar(&chunkMemoryMB, "chunk-memory", constants.DefaultChunkMemoryMB, "megabytes of chords to sort in memory when making chunks before using temp files")
+	indexCmd.MarkFlagsMutuallyExclusive("incremental", "resume")
 	rootCmd.AddCommand(indexCmd)
 }
 
@@ -28,7 +46,13 @@ var indexCmd = &cobra.Command{
 			maxNum = arg1
 		}
 
-		Index(maxNum)
+		if incremental {
+			IndexIncremental(maxNum)
+		} else if resume {
+			ResumeIndex()
+		} else {
+			Index(maxNum)
+		}
 	},
 }
 
@@ -36,9 +60,98 @@ func Index(maxNum int) {
 	util.RecreateOutputDir()
 	paths := util.GatherAllMidiPaths(maxNum)
 	fileNumMap := file.CreateFileNumMap(paths)
-	bucket.ProcessAllMidiFiles(fileNumMap)
-	chunks := chunk.CreateAll()
-	util.CreateBinary(util.GetAllChunksPath(), chunks)
+	// NOTE: saved first so resuming uses the same file numbers
 	util.CreateBinary(util.GetFileNumToNamePath(), fileNumMap)
+	buildIndex(fileNumMap)
+}
+
+// ResumeIndex continues building an index after the last checkpoint of an
+// Index that didn't finish
+func ResumeIndex() {
+	if util.Exists(util.GetManifestPath()) {
+		fmt.Println("Index already finished building")
+		return
+	}
+	if !util.Exists(util.GetFileNumToNamePath()) {
+		panic("There's no index to resume, it has to be built from scratch")
+	}
+	buildIndex(util.ReadBinaryOrPanic[model.FileNumToMidiPath](util.GetFileNumToNamePath()))
+}
+
+func buildIndex(fileNumMap model.FileNumToMidiPath) {
+	files := bucket.ProcessAllMidiFiles(fileNumMap, file.NewIndexedFiles(), numIndexWorkers, dedupNotes)
+	chunks := chunk.CreateAll(chunkMemoryMB * 1024 * 1024)
+	dictionary.Write(chunks)
+	util.CreateBinary(util.GetAllChunksPath(), chunks)
+	writeIndexedFiles(files)
+	manifest.Write(manifest.Create(len(fileNumMap), uint32(len(fileNumMap))))
+	chunk.DeleteCheckpoint()
 	// bucket.DeleteAll()
 }
+
+// IndexIncremental indexes the midi files that aren't in the index yet into
+// delta chunks that are searched alongside the existing ones. Existing file
+// numbers stay the same and removed files aren't indexed again.
+func IndexIncremental(maxNum int) {
+	m := manifest.ReadOrPanic()
+	if !manifest.HasSameBuildParameters(m) {
+		panic("Index was built with different parameters, it has to be rebuilt")
+	}
+	chunk.DeleteUnreferenced()
+
+	files := readIndexedFiles()
+	var paths []string
+	for _, path := range util.GatherAllMidiPaths(maxNum) {
+		if !files.Removed.Paths[path] {
+			paths = append(paths, path)
+		}
+	}
+	fileNumMap := util.ReadBinaryOrPanic[model.FileNumToMidiPath](util.GetFileNumToNamePath())
+	newFileNumMap := file.ExtendFileNumMap(fileNumMap, paths, m.MaxFileNum)
+	if len(newFileNumMap) == 0 {
+		fmt.Println("No new midi files to index")
+		return
+	}
+
+	// the buckets from last time are already in chunks
+	bucket.DeleteAll()
+	chunk.DeleteCheckpoint()
+
+	files = bucket.ProcessAllMidiFiles(newFileNumMap, files, numIndexWorkers, dedupNotes)
+
+	deltaChunks := chunk.CreateAll(chunkMemoryMB * 1024 * 1024)
+	chunks := util.ReadBinaryOrPanic[[]model.ChunkOverview](util.GetAllChunksPath())
+	chunks = append(chunks, deltaChunks...)
+
+	dictionary.Write(chunks)
+	util.ReplaceBinary(util.GetAllChunksPath(), chunks)
+	util.CreateBinary(util.GetFileNumToNamePath(), fileNumMap)
+	writeIndexedFiles(files)
+	next := manifest.Create(len(fileNumMap), m.MaxFileNum+uint32(len(newFileNumMap)))
+	next.Generation = m.Generation
+	manifest.Write(next)
+	chunk.DeleteCheckpoint()
+}
+
+func readIndexedFiles() model.IndexedFiles {
+	var res model.IndexedFiles
+	res.Keys = util.ReadBinaryOrPanic[model.FileNumToKey](util.GetFileKeysPath())
+	res.Hashes = util.ReadBinaryOrPanic[model.FileHashToFileNum](util.GetFileHashesPath())
+	res.AlternatePaths = util.ReadBinaryOrPanic[model.FileNumToAlternatePaths](util.GetAlternatePathsPath())
+	res.Removed = util.ReadBinaryOrPanic[model.RemovedFiles](util.GetRemovedFilesPath())
+	// NOTE: gob leaves out empty maps
+	if res.Removed.Paths == nil {
+		res.Removed.Paths = make(map[string]bool)
+	}
+	if res.Removed.Hashes == nil {
+		res.Removed.Hashes = make(map[string]bool)
+	}
+	return res
+}
+
+func writeIndexedFiles(files model.IndexedFiles) {
+	util.CreateBinary(util.GetFileKeysPath(), files.Keys)
+	util.CreateBinary(util.GetFileHashesPath(), files.Hashes)
+	util.CreateBinary(util.GetAlternatePathsPath(), files.AlternatePaths)
+	util.CreateBinary(util.GetRemovedFilesPath(), files.Removed)
+}
@@ -26,11 +26,9 @@ var inspectCmd = &cobra.Command{
 
 func inspect(path string) {
 	f := util.OpenFileOrPanic(path)
-	index, _ := chunk.ReadIndexOrPanic(f)
-	keys := util.GetKeys(index)
-	for _, key := range keys {
-		val, _ := index[key]
-		fmt.Printf("key: %v\n", key)
-		fmt.Printf("val: %v\n", val)
+	t, _ := chunk.ReadKeyTableOrPanic(f)
+	for i := 0; i < t.Len(); i++ {
+		fmt.Printf("key: %v\n", t.Key(i))
+		fmt.Printf("val: %v\n", t.Entry(i))
 	}
 }
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/jsphweid/harmondex/model"
+)
+
+var sortFieldToLess = map[string]func(a model.MidiMetadata, b model.MidiMetadata) bool{
+	"year":   func(a, b model.MidiMetadata) bool { return a.Year < b.Year },
+	"artist": func(a, b model.MidiMetadata) bool { return strings.ToLower(a.Artist) < strings.ToLower(b.Artist) },
+	"title":  func(a, b model.MidiMetadata) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) },
+}
+
+func passesFilter(metadata model.MidiMetadata, filter model.MetadataFilter) bool {
+	if filter.MinYear != 0 && metadata.Year < filter.MinYear {
+		return false
+	}
+	if filter.MaxYear != 0 && metadata.Year > filter.MaxYear {
+		return false
+	}
+	if !strings.Contains(strings.ToLower(metadata.Artist), strings.ToLower(filter.Artist)) {
+		return false
+	}
+	if !strings.Contains(strings.ToLower(metadata.Title), strings.ToLower(filter.Title)) {
+		return false
+	}
+	return true
+}
+
+// applyMetadataOptions filters and sorts matches by the metadata of their
+// files. It needs the metadata of every matched file so it's only done when
+// asked for.
+func applyMetadataOptions(matches []model.RawResult, filter *model.MetadataFilter, sortBy string) ([]model.RawResult, error) {
+	descending := strings.HasPrefix(sortBy, "-")
+	less, ok := sortFieldToLess[strings.TrimPrefix(sortBy, "-")]
+	if sortBy != "" && !ok {
+		return matches, errors.New("Unknown sort: " + sortBy)
+	}
+
+	if filter == nil && sortBy == "" {
+		return matches, nil
+	}
+
+	var fileIds []uint32
+	seen := make(map[uint32]bool)
+	for _, match := range matches {
+		if !seen[match.FileId] {
+			seen[match.FileId] = true
+			fileIds = append(fileIds, match.FileId)
+		}
+	}
+	fileIdToMetadata := fetchMidiMetadata(fileIds)
+
+	var res []model.RawResult
+	for _, match := range matches {
+		metadata, ok := fileIdToMetadata[match.FileId]
+		if filter != nil && (!ok || !passesFilter(metadata, *filter)) {
+			continue
+		}
+		res = append(res, match)
+	}
+
+	if sortBy != "" {
+		// files without metadata go last either way
+		sort.SliceStable(res, func(i, j int) bool {
+			a, aOk := fileIdToMetadata[res[i].FileId]
+			b, bOk := fileIdToMetadata[res[j].FileId]
+			if !aOk || !bOk {
+				return aOk && !bOk
+			}
+			if descending {
+				return less(b, a)
+			}
+			return less(a, b)
+		})
+	}
+
+	return res, nil
+}
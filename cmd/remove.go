@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jsphweid/harmondex/file"
+	"github.com/jsphweid/harmondex/manifest"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(removeCmd)
+}
+
+var removeCmd = &cobra.Command{
+	Use:   "remove <path>",
+	Short: "Removes a midi file from the index",
+	Long: `Marks the midi file as deleted so it isn't returned anymore, a running
+server stops returning it from its next request on. Its postings stay in the
+chunks until the index is compacted. Neither the file nor copies of it are
+indexed again.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		removed := Remove(args[0])
+		if len(removed) == 0 {
+			fmt.Println("No indexed midi file matches " + args[0])
+			os.Exit(1)
+		}
+		fmt.Printf("Removed file nums %v\n", removed)
+	},
+}
+
+// Remove marks every file stored under path as deleted and returns their
+// nums. A file with copies that weren't removed is replaced by one of the
+// copies instead so the copies are still returned. The path, and the content
+// of files without copies left, are remembered so they aren't indexed again.
+func Remove(path string) []uint32 {
+	fileNumMap := util.ReadBinaryOrPanic[model.FileNumToMidiPath](util.GetFileNumToNamePath())
+	deleted := file.ReadDeletedFiles()
+	files := readIndexedFiles()
+
+	var res []uint32
+	for _, num := range file.FindFileNums(fileNumMap, path) {
+		if deleted[num] {
+			continue
+		}
+		res = append(res, num)
+		files.Removed.Paths[fileNumMap[num]] = true
+		if copyNum, ok := promoteCopy(fileNumMap, files.AlternatePaths, deleted, num); ok {
+			// NOTE: the copy's num never had postings, and now has path
+			deleted[copyNum] = true
+		} else {
+			deleted[num] = true
+			for hash, hashNum := range files.Hashes {
+				if hashNum == num {
+					files.Removed.Hashes[hash] = true
+				}
+			}
+		}
+	}
+
+	// NOTE: the removed files go last since a running server reloads
+	// everything once they change
+	if len(res) > 0 {
+		m := manifest.ReadOrPanic()
+		m.Generation += 1
+		manifest.Write(m)
+		util.CreateBinary(util.GetFileNumToNamePath(), fileNumMap)
+		writeIndexedFiles(files)
+		util.ReplaceBinary(util.GetDeletedFilesPath(), deleted)
+	}
+	return res
+}
+
+// promoteCopy stores the file num under the path of its first copy that
+// wasn't removed, swapping paths with the copy's own num, which is returned
+func promoteCopy(fileNumMap model.FileNumToMidiPath, alternatePaths model.FileNumToAlternatePaths, deleted model.FileNumSet, num uint32) (uint32, bool) {
+	paths := alternatePaths[num]
+	for i, path := range paths {
+		for _, copyNum := range file.FindFileNums(fileNumMap, path) {
+			if copyNum == num || deleted[copyNum] {
+				continue
+			}
+			fileNumMap[num], fileNumMap[copyNum] = path, fileNumMap[num]
+			if len(paths) > 1 {
+				alternatePaths[num] = append(paths[:i:i], paths[i+1:]...)
+			} else {
+				delete(alternatePaths, num)
+			}
+			return copyNum, true
+		}
+	}
+	return 0, false
+}
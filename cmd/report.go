@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"regexp"
 
+	"github.com/jsphweid/harmondex/bucket"
 	"github.com/jsphweid/harmondex/chunk"
 	"github.com/jsphweid/harmondex/constants"
 	"github.com/jsphweid/harmondex/util"
@@ -45,17 +46,16 @@ type chunksReport struct {
 func analyzeBuckets() bucketsReport {
 	var report bucketsReport
 
-	files, err := ioutil.ReadDir(util.GetIndexDir())
+	files, err := ioutil.ReadDir(util.GetBucketDir())
 	if err != nil {
 		panic("Could not read dir because: " + err.Error())
 	}
 
-	r, _ := regexp.Compile(`^\d\d\d\.dat$`)
 	for _, file := range files {
 		filename := file.Name()
-		if r.MatchString(filename) {
+		if bucket.IsBucketFile(filename) {
 			report.numFiles += 1
-			path := filepath.Join(util.GetIndexDir(), filename)
+			path := filepath.Join(util.GetBucketDir(), filename)
 			f, err := os.Open(path)
 			if err != nil {
 				panic("Could not open file")
@@ -85,16 +85,12 @@ func analyzeChunks() chunksReport {
 		if r.MatchString(filename) {
 			report.numFiles += 1
 			f := util.OpenFileOrPanic(filepath.Join(util.GetIndexDir(), filename))
-			index, indexLength := chunk.ReadIndexOrPanic(f)
+			t, indexLength := chunk.ReadKeyTableOrPanic(f)
 
 			// count chords
 			var chordsInIndex int64
-			keys := make([]string, 0, len(index))
-			for k := range index {
-				keys = append(keys, k)
-			}
-			for _, v := range keys {
-				chordsInIndex += int64(index[v].End-index[v].Start) / 8
+			for i := 0; i < t.Len(); i++ {
+				chordsInIndex += int64(t.Entry(i).NumPostings)
 			}
 
 			chordsInIndexes := report.chordsInIndexes
@@ -114,7 +110,7 @@ func analyzeChunks() chunksReport {
 
 			dataBytes := stats.Size() - int64(indexLength+4)
 			report.dataBytes += dataBytes
-			report.numChords += (dataBytes / 8)
+			report.numChords += chordsInIndex
 			f.Close()
 		}
 	}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jsphweid/harmondex/chord"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/search"
+	"github.com/spf13/cobra"
+)
+
+var anyVoicing bool
+var searchMode string
+var numResults int
+
+func init() {
+	searchCmd.Flags().BoolVar(&anyVoicing, "any-voicing", false, "match any voicing of the chords")
+	searchCmd.Flags().StringVar(&searchMode, "mode", model.ExactSearch, "search mode")
+	searchCmd.Flags().IntVar(&numResults, "num", 10, "number of files to print")
+	rootCmd.AddCommand(searchCmd)
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search [chord symbols...]",
+	Short: "Searches the index for chord symbols",
+	Long:  `Searches the index for chord symbols like "Cmaj7/E" or "G7b9". More than one symbol searches for a progression.`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		input := model.SearchRequestBody{Symbols: args, Mode: searchMode}
+		if anyVoicing {
+			input.Voicing = model.AnyVoicing
+			if !cmd.Flags().Changed("mode") {
+				input.Mode = ""
+			}
+		}
+		err := resolveSymbols(&input)
+		if err != nil {
+			panic(err)
+		}
+		LoadServeFiles()
+		printSearchResults(index.FindProgression(input.Chords, search.Options{
+			Mode:        input.Mode,
+			MaxDistance: constants.DefaultMaxDistance,
+		}))
+	},
+}
+
+// resolveSymbols turns the chord symbols in input into chords. Any voicing
+// is a pitch class search so those become pitch classes instead of notes.
+func resolveSymbols(input *model.SearchRequestBody) error {
+	if len(input.Symbols) == 0 {
+		return nil
+	}
+	if len(input.Chords) > 0 {
+		return errors.New("Send chords or symbols, not both")
+	}
+	if input.Voicing == model.AnyVoicing && input.Mode != "" && input.Mode != model.PitchClassSearch {
+		return errors.New("Any voicing is a pitch class search, it can't be used with mode " + input.Mode)
+	}
+
+	for _, text := range input.Symbols {
+		symbol, err := chord.ParseSymbol(text)
+		if err != nil {
+			return err
+		}
+		switch input.Voicing {
+		case "", model.ExactVoicing:
+			input.Chords = append(input.Chords, symbol.Notes())
+		case model.AnyVoicing:
+			input.Chords = append(input.Chords, symbol.PitchClasses())
+		default:
+			return errors.New("Unknown voicing: " + input.Voicing)
+		}
+	}
+
+	if input.Voicing == model.AnyVoicing {
+		input.Mode = model.PitchClassSearch
+	}
+	return nil
+}
+
+func printSearchResults(matches []model.RawResult, truncated bool) {
+	var uniqueFileIds []uint32
+	fileIdToOffsets := make(map[uint32][]uint32)
+	for _, match := range matches {
+		if _, ok := fileIdToOffsets[match.FileId]; !ok {
+			uniqueFileIds = append(uniqueFileIds, match.FileId)
+		}
+		fileIdToOffsets[match.FileId] = append(fileIdToOffsets[match.FileId], match.AbsTickOffset)
+	}
+
+	fmt.Printf("%v matches in %v files\n", len(matches), len(uniqueFileIds))
+	if truncated {
+		fmt.Printf("Only the first %v chords that matched were searched\n", constants.MaxKeysPerQuery)
+	}
+	for i, id := range uniqueFileIds {
+		if i == numResults {
+			break
+		}
+		fmt.Printf("%v %v: %v\n", id, fileNumMap[id], fileIdToOffsets[id])
+	}
+}
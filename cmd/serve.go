@@ -1,32 +1,61 @@
 package cmd
 
 import (
-	"encoding/binary"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"hash/crc32"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jsphweid/harmondex/chord"
-	"github.com/jsphweid/harmondex/chunk"
+	"github.com/jsphweid/harmondex/constants"
 	"github.com/jsphweid/harmondex/db"
+	"github.com/jsphweid/harmondex/manifest"
+	"github.com/jsphweid/harmondex/midi"
 	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/search"
+	"github.com/jsphweid/harmondex/tonality"
 	"github.com/jsphweid/harmondex/util"
 	"github.com/rs/cors"
 	"github.com/spf13/cobra"
 )
 
-var allChunks []model.ChunkOverview
+var index *search.Index
 var fileNumMap model.FileNumToMidiPath
+var alternatePaths model.FileNumToAlternatePaths
+
+// metadata of every file looked up since the index was loaded, nil for files
+// without any
+var metadataCache map[uint32]*model.MidiMetadata
+var metadataCacheMutex sync.Mutex
+
+// held for reading while a request uses the files loaded by LoadServeFiles
+// so they aren't reloaded in the middle of it
+var serveFilesMutex sync.RWMutex
+
+// when the removed files were changed as of LoadServeFiles, zero if there
+// weren't any
+var deletedFilesModTime time.Time
+
+// when the served index was built and its generation, so cursors from
+// another index (or from before files were removed) are refused
+var indexBuiltAt int64
+var indexGeneration uint32
+
+var maxFilesPerPage int
 
 func init() {
 	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().IntVar(&maxFilesPerPage, "max-limit", constants.MaxFilesPerPage, "most files a page of search results can have")
 }
 
 var serveCmd = &cobra.Command{
@@ -38,81 +67,60 @@ var serveCmd = &cobra.Command{
 	},
 }
 
-func parseResult(buf []byte) []model.RawResult {
-	var res []model.RawResult
-	for i := 0; i < len(buf); i += 8 {
-		var rr model.RawResult
-		rr.AbsTickOffset = binary.LittleEndian.Uint32(buf[i : i+4])
-		rr.FileId = binary.LittleEndian.Uint32(buf[i+4 : i+8])
-		res = append(res, rr)
-	}
-	return res
-}
-
-func findChordsInChunk(filename string, chordKey string) []model.RawResult {
-	// read chunk
-	f := util.OpenFileOrPanic(filepath.Join(util.GetIndexDir(), filename))
-	index, _ := chunk.ReadIndexOrPanic(f)
-
-	val, ok := index[chordKey]
-	if ok {
-		// advance file byte pointer to start position from current
-		// TODO: add pagination
-		f.Seek(int64(val.Start), os.SEEK_CUR)
-		bytesToRead := val.End - val.Start
-		buf := make([]byte, bytesToRead)
-		_, err := io.ReadFull(f, buf)
-		if err != nil {
-			panic("Could not read from seeked positon: " + err.Error())
-		}
-		return parseResult(buf)
-	}
-
-	var emptyResults []model.RawResult
-	return emptyResults
-}
-
-func findChords(notes model.Notes) []model.RawResult {
-	var empty []model.RawResult
-
-	if len(notes) == 0 {
-		return empty
-	}
-
-	chordKey := chord.CreateChordKey(notes)
-	for _, chunk := range allChunks {
-		if chordKey >= chunk.Start && chordKey <= chunk.End {
-			return findChordsInChunk(chunk.Filename, chordKey)
-		}
-	}
-
-	return empty
-}
-
+// fetchMidiMetadata returns the metadata of the files that have any. Each
+// file is only looked up in the db the first time it's asked for.
 func fetchMidiMetadata(fileIds []uint32) map[uint32]model.MidiMetadata {
 	res := make(map[uint32]model.MidiMetadata)
 	var filenames []string
 	filenameToFileId := make(map[string]uint32)
+
+	metadataCacheMutex.Lock()
 	for _, fileId := range fileIds {
-		filename := fileNumMap[fileId]
-		filenames = append(filenames, filename)
-		filenameToFileId[filename] = fileId
+		if metadata, ok := metadataCache[fileId]; ok {
+			if metadata != nil {
+				res[fileId] = *metadata
+			}
+		} else if _, ok := filenameToFileId[fileNumMap[fileId]]; !ok {
+			filename := fileNumMap[fileId]
+			filenames = append(filenames, filename)
+			filenameToFileId[filename] = fileId
+		}
+	}
+	metadataCacheMutex.Unlock()
+	if len(filenames) == 0 {
+		return res
 	}
-	filenameToMetadata := db.GetMidiMetadatas(filenames)
-	for filename, metadata := range filenameToMetadata {
-		res[filenameToFileId[filename]] = metadata
+
+	// NOTE: not holding the lock so searches that are cached don't wait
+	filenameToMetadata := db.GetAllMidiMetadatas(filenames)
+
+	metadataCacheMutex.Lock()
+	defer metadataCacheMutex.Unlock()
+	for filename, fileId := range filenameToFileId {
+		if metadata, ok := filenameToMetadata[filename]; ok {
+			res[fileId] = metadata
+			metadataCache[fileId] = &metadata
+		} else {
+			metadataCache[fileId] = nil
+		}
 	}
 	return res
 }
 
-func handleGetFile(w http.ResponseWriter, r *http.Request) {
+// HandleGetFile sends the midi file with the id in the url
+func HandleGetFile(w http.ResponseWriter, r *http.Request) {
+	defer useServeFiles()()
 	id := mux.Vars(r)["id"]
 	fileNum, err := strconv.Atoi(id)
 	if err != nil {
 		return
 	}
-	if filename, ok := fileNumMap[uint32(fileNum)]; ok {
-		path := filepath.Join(util.GetMediaDir(), filename)
+	if index.DeletedFiles[uint32(fileNum)] {
+		http.NotFound(w, r)
+		return
+	}
+	if relPath, ok := fileNumMap[uint32(fileNum)]; ok {
+		path := filepath.Join(util.GetMediaDir(), relPath)
 		bytes, err := ioutil.ReadFile(path)
 		if err != nil {
 			fmt.Println("Error reading midi file: " + err.Error())
@@ -122,11 +130,99 @@ func handleGetFile(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func sendSearchResponse(w http.ResponseWriter, matches []model.RawResult, start int) {
+// pageOptions are which page of a search to send
+type pageOptions struct {
+	cursor search.Cursor
+	limit  int
+
+	// of everything about the request besides the page, so a cursor can
+	// only be used for the search it came from
+	fingerprint uint32
+}
+
+// cursorToken is what's in the opaque cursors sent to clients
+type cursorToken struct {
+	search.Cursor
+	Search     uint32
+	BuiltAt    int64
+	Generation uint32
+}
+
+func encodeCursor(cursor search.Cursor, fingerprint uint32) string {
+	token := cursorToken{cursor, fingerprint, indexBuiltAt, indexGeneration}
+	bytes, err := json.Marshal(token)
+	if err != nil {
+		panic("Could not encode cursor: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
+
+func decodeCursor(s string, fingerprint uint32) (search.Cursor, error) {
+	var token cursorToken
+	bytes, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(bytes, &token)
+	}
+	if err != nil || token.Start < 0 || token.Location < 0 {
+		return token.Cursor, errors.New("Invalid cursor")
+	}
+	if token.Search != fingerprint {
+		return token.Cursor, errors.New("Cursor is from a different search")
+	}
+	if token.BuiltAt != indexBuiltAt || token.Generation != indexGeneration {
+		return token.Cursor, errors.New("Cursor is from an index that isn't served anymore, start the search over")
+	}
+	return token.Cursor, nil
+}
+
+// getPageOptions reads the page to send from the url. A cursor is used over
+// start when there is one and limit is capped at maxFilesPerPage.
+func getPageOptions(r *http.Request, reqBody []byte) (pageOptions, error) {
+	var res pageOptions
+	query := r.URL.Query()
+
+	res.limit = util.Min(constants.FilesPerPage, maxFilesPerPage)
+	if limit := query.Get("limit"); limit != "" {
+		num, err := strconv.Atoi(limit)
+		if err != nil || num <= 0 {
+			return res, errors.New("limit has to be a positive number: " + limit)
+		}
+		res.limit = util.Min(num, maxFilesPerPage)
+	}
+
+	cursor := query.Get("cursor")
+	query.Del("cursor")
+	query.Del("limit")
+	query.Del("start")
+	res.fingerprint = crc32.Update(crc32.ChecksumIEEE(reqBody), crc32.IEEETable, []byte(query.Encode()))
+
+	if cursor != "" {
+		var err error
+		res.cursor, err = decodeCursor(cursor, res.fingerprint)
+		return res, err
+	}
+	if start, err := strconv.Atoi(r.URL.Query().Get("start")); err == nil && start > 0 {
+		res.cursor.Start = start
+	}
+	return res, nil
+}
+
+func sendSearchResponse(w http.ResponseWriter, r *http.Request, matches []model.RawResult, truncated bool, mode model.SearchMode, pageOpts pageOptions) {
+	page := search.Paginate(matches, pageOpts.cursor.Start, pageOpts.limit)
+	page.Truncated = truncated
+	sendPage(w, r, page, mode, pageOpts)
+}
+
+func sendPage(w http.ResponseWriter, r *http.Request, page search.Page, mode model.SearchMode, pageOpts pageOptions) {
+	explain := r.URL.Query().Get("explain") == "true"
+
 	var uniqueFileIds []uint32
 	fileIdToOffsets := make(map[uint32][]uint32)
+	fileIdToTranspositions := make(map[uint32][]int8)
+	fileIdToDistances := make(map[uint32][]int)
+	fileIdToExplanations := make(map[uint32][]model.HitExplanation)
 
-	for _, match := range matches {
+	for _, match := range page.Matches {
 		absTickOffset := match.AbsTickOffset
 		if absTickOffsets, ok := fileIdToOffsets[match.FileId]; ok {
 			fileIdToOffsets[match.FileId] = append(absTickOffsets, absTickOffset)
@@ -134,25 +230,40 @@ func sendSearchResponse(w http.ResponseWriter, matches []model.RawResult, start
 			uniqueFileIds = append(uniqueFileIds, match.FileId)
 			fileIdToOffsets[match.FileId] = []uint32{absTickOffset}
 		}
+		if mode == model.TransposedSearch {
+			fileIdToTranspositions[match.FileId] = append(fileIdToTranspositions[match.FileId], match.Transposition)
+		}
+		if mode == model.ApproximateSearch {
+			fileIdToDistances[match.FileId] = append(fileIdToDistances[match.FileId], int(match.Distance))
+		}
+		if explain {
+			fileIdToExplanations[match.FileId] = append(fileIdToExplanations[match.FileId], explainHit(match))
+		}
 	}
 
 	var resp model.SearchResponse
-	resp.NumFiles = len(uniqueFileIds)
-	resp.NumMatches = len(matches)
-	resp.Start = start // TODO: is this really that valuable?
-	resp.Results = []model.SearchResultV2{}
-
-	if start >= len(uniqueFileIds) {
-		json.NewEncoder(w).Encode(resp)
-		return
+	resp.Approximate = mode == model.ApproximateSearch
+	resp.NumFiles = page.NumFiles
+	resp.NumMatches = page.NumMatches
+	resp.Truncated = page.Truncated
+	resp.Start = page.Start // TODO: is this really that valuable?
+	if page.Next != nil {
+		resp.NextCursor = encodeCursor(*page.Next, pageOpts.fingerprint)
 	}
+	resp.Results = []model.SearchResultV2{}
 
-	ids := uniqueFileIds[start:util.Min(len(uniqueFileIds), start+10)]
-	fileIdToMetadata := fetchMidiMetadata(ids)
-	for _, id := range ids {
+	fileIdToMetadata := fetchMidiMetadata(uniqueFileIds)
+	for _, id := range uniqueFileIds {
 		var sr model.SearchResultV2
 		sr.FileId = id
 		sr.AbsTickOffsets = fileIdToOffsets[id]
+		sr.Transpositions = fileIdToTranspositions[id]
+		sr.Distances = fileIdToDistances[id]
+		sr.Explanations = fileIdToExplanations[id]
+		sr.AlternatePaths = alternatePaths[id]
+		if mode == model.NumeralSearch {
+			sr.Key = tonality.Name(index.FileKeys[id])
+		}
 		sr.MidiMetadata = nil
 		if _, ok := fileIdToMetadata[id]; ok {
 			val := fileIdToMetadata[id]
@@ -164,18 +275,112 @@ func sendSearchResponse(w http.ResponseWriter, matches []model.RawResult, start
 	json.NewEncoder(w).Encode(resp)
 }
 
-func getStart(r *http.Request) int {
-	start := r.URL.Query().Get("start")
-	num, err := strconv.Atoi(start)
+// findProgression finds chords like index.FindProgression but falls back to
+// near matches when an exact search doesn't match anything. The options that
+// were actually used are returned.
+func findProgression(chords []model.Notes, opts search.Options) ([]model.RawResult, bool, search.Options) {
+	if opts.MaxDistance <= 0 {
+		opts.MaxDistance = constants.DefaultMaxDistance
+	}
+
+	matches, truncated := index.FindProgression(chords, opts)
+	if len(matches) == 0 && (opts.Mode == "" || opts.Mode == model.ExactSearch) {
+		// user entered chords often have a slipped note so try near ones
+		opts.Mode = model.ApproximateSearch
+		matches, truncated = index.FindProgression(chords, opts)
+	}
+	return matches, truncated, opts
+}
+
+// HandleSearchByExample searches for the chord progression in the midi file
+// sent as the request body
+func HandleSearchByExample(w http.ResponseWriter, r *http.Request) {
+	defer useServeFiles()()
+	r.Body = http.MaxBytesReader(w, r.Body, constants.MaxExampleBytes)
+	reqBody, err := ioutil.ReadAll(r.Body)
+	if err != nil && len(reqBody) == constants.MaxExampleBytes {
+		// NOTE: MaxBytesReader stops right at the limit when it's exceeded
+		http.Error(w, fmt.Sprintf("Midi file can't be bigger than %v bytes", constants.MaxExampleBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Could not read request body: "+err.Error(), 400)
+		return
+	}
+
+	pageOpts, err := getPageOptions(r, reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	parsed, err := midi.ReadMidi(reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	chords, err := chord.GetChords(parsed, false)
+	if err != nil || len(chords) == 0 {
+		http.Error(w, "Could not find any chords in midi file", 400)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if !search.IsValidMode(mode) {
+		http.Error(w, "Unknown search mode: "+mode, 400)
+		return
+	}
+
+	var progression []model.Notes
+	for _, c := range chords[:util.Min(len(chords), constants.MaxExampleChords)] {
+		progression = append(progression, c.Notes)
+	}
+
+	matches, truncated, opts := findProgression(progression, search.Options{Mode: mode})
+	matches, err = filterHits(matches, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	sendSearchResponse(w, r, matches, truncated, opts.Mode, pageOpts)
+}
+
+func handleNumeralSearch(w http.ResponseWriter, r *http.Request, input model.SearchRequestBody, pageOpts pageOptions) {
+	if len(input.Chords) > 0 || len(input.Symbols) > 0 {
+		http.Error(w, "Send numerals, chords or symbols, not more than one", 400)
+		return
+	}
+
+	if input.KeyMode != "" && input.KeyMode != model.MajorKey && input.KeyMode != model.MinorKey {
+		http.Error(w, "Unknown key mode: "+input.KeyMode, 400)
+		return
+	}
+
+	matches, err := index.FindNumeralProgression(input.Numerals, input.KeyMode == model.MinorKey)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	matches, err = filterHits(matches, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 
+	matches, err = applyMetadataOptions(matches, input.Filter, input.Sort)
 	if err != nil {
-		return 0
+		http.Error(w, err.Error(), 400)
+		return
 	}
 
-	return num
+	sendSearchResponse(w, r, matches, false, model.NumeralSearch, pageOpts)
 }
 
 func HandleSearch(w http.ResponseWriter, r *http.Request) {
+	defer useServeFiles()()
 	reqBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		fmt.Println(w, "Kindly enter data with the event title and description only in order to update")
@@ -188,14 +393,57 @@ func HandleSearch(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("Could not unmarshal request body: " + err.Error())
 	}
 
-	if len(input.Chords) != 1 {
-		http.Error(w, "Length of chords can only be 1 for now...", 400)
+	pageOpts, err := getPageOptions(r, reqBody)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if len(input.Numerals) > 0 {
+		handleNumeralSearch(w, r, input, pageOpts)
+		return
+	}
+
+	err = resolveSymbols(&input)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	if len(input.Chords) == 0 {
+		http.Error(w, "Need at least 1 chord...", 400)
+		return
+	}
+
+	if !search.IsValidMode(input.Mode) {
+		http.Error(w, "Unknown search mode: "+input.Mode, 400)
+		return
+	}
+
+	opts := search.Options{Mode: input.Mode, MaxDistance: input.MaxDistance}
+	if len(input.Chords) == 1 && !hasHitFilters(r.URL.Query()) && input.Filter == nil && input.Sort == "" {
+		// only the postings of the files on the page have to be read
+		page := index.FindChordsPage(input.Chords[0], opts, pageOpts.cursor, pageOpts.limit)
+		if page.NumFiles > 0 {
+			sendPage(w, r, page, opts.Mode, pageOpts)
+			return
+		}
+	}
+	matches, truncated, opts := findProgression(input.Chords, opts)
+
+	matches, err = filterHits(matches, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	matches, err = applyMetadataOptions(matches, input.Filter, input.Sort)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
 		return
 	}
 
-	matches := findChords(input.Chords[0])
-	start := getStart(r)
-	sendSearchResponse(w, matches, start)
+	sendSearchResponse(w, r, matches, truncated, opts.Mode, pageOpts)
 }
 
 func UnauthorizedHandler(w http.ResponseWriter, r *http.Request) {
@@ -203,18 +451,83 @@ func UnauthorizedHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "401 Unauthorized\n")
 }
 
+func getDeletedFilesModTime() time.Time {
+	stats, err := os.Stat(util.GetDeletedFilesPath())
+	if err != nil {
+		return time.Time{}
+	}
+	return stats.ModTime()
+}
+
+// useServeFiles reloads the index if files were removed from it or it was
+// compacted since it was loaded, and keeps it from being reloaded until the
+// returned func is called
+func useServeFiles() func() {
+	modTime := getDeletedFilesModTime()
+	serveFilesMutex.RLock()
+	if modTime.Equal(deletedFilesModTime) {
+		return serveFilesMutex.RUnlock
+	}
+	serveFilesMutex.RUnlock()
+
+	serveFilesMutex.Lock()
+	if !modTime.Equal(deletedFilesModTime) {
+		LoadServeFiles()
+	}
+	serveFilesMutex.Unlock()
+
+	serveFilesMutex.RLock()
+	return serveFilesMutex.RUnlock
+}
+
 func LoadServeFiles() {
 	// NOTE: this should be exposed but I don't immediately know a
 	// better way to make this file easily testable than to do this
-	allChunks = util.ReadBinaryOrPanic[[]model.ChunkOverview](util.GetAllChunksPath())
+	deletedFilesModTime = getDeletedFilesModTime()
+	m := manifest.ReadOrPanic()
+	indexBuiltAt = m.BuiltAt.UnixNano()
+	indexGeneration = m.Generation
+	if index != nil {
+		index.Close()
+	}
+	index = search.LoadIndex()
 	fileNumMap = util.ReadBinaryOrPanic[model.FileNumToMidiPath](util.GetFileNumToNamePath())
+	metadataCacheMutex.Lock()
+	metadataCache = make(map[uint32]*model.MidiMetadata)
+	metadataCacheMutex.Unlock()
+	alternatePaths = withoutRemovedPaths(util.ReadBinaryOrPanic[model.FileNumToAlternatePaths](util.GetAlternatePathsPath()))
+}
+
+// withoutRemovedPaths takes the paths of removed files out of alternatePaths,
+// which compacting does for good
+func withoutRemovedPaths(alternatePaths model.FileNumToAlternatePaths) model.FileNumToAlternatePaths {
+	removedPaths := make(map[string]bool)
+	for num := range index.DeletedFiles {
+		removedPaths[fileNumMap[num]] = true
+	}
+	res := make(model.FileNumToAlternatePaths)
+	for num, paths := range alternatePaths {
+		for _, path := range paths {
+			if !removedPaths[path] {
+				res[num] = append(res[num], path)
+			}
+		}
+	}
+	return res
 }
 
 func serve() {
+	if maxFilesPerPage < 1 {
+		log.Fatal("--max-limit has to be at least 1")
+	}
+	if _, err := manifest.Read(); err != nil {
+		log.Fatal("Refusing to serve index: " + err.Error())
+	}
 	LoadServeFiles()
 	router := mux.NewRouter()
 	router.HandleFunc("/search", HandleSearch).Methods("POST")
-	router.HandleFunc("/file/{id}", handleGetFile).Methods("GET")
+	router.HandleFunc("/search/midi", HandleSearchByExample).Methods("POST")
+	router.HandleFunc("/file/{id}", HandleGetFile).Methods("GET")
 
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3500"},
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jsphweid/harmondex/chunk"
+	"github.com/jsphweid/harmondex/dictionary"
+	"github.com/jsphweid/harmondex/manifest"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Checks that the index is intact",
+	Long:  `Checks that every chunk of the index is intact and agrees with the rest of the index`,
+	Run: func(cmd *cobra.Command, args []string) {
+		problems := Verify()
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) > 0 {
+			fmt.Printf("Found %v problems\n", len(problems))
+			os.Exit(1)
+		}
+		fmt.Println("Index is intact")
+	},
+}
+
+// Verify returns everything that's wrong with the index
+func Verify() []error {
+	_, err := manifest.Read()
+	if err != nil {
+		return []error{err}
+	}
+
+	chunks := util.ReadBinaryOrPanic[[]model.ChunkOverview](util.GetAllChunksPath())
+	fileNumMap := util.ReadBinaryOrPanic[model.FileNumToMidiPath](util.GetFileNumToNamePath())
+
+	var res []error
+	for i, c := range chunks {
+		fmt.Printf("Verifying %v of %v chunks\n", i+1, len(chunks))
+		res = append(res, chunk.Verify(c, fileNumMap)...)
+	}
+	if len(res) == 0 {
+		// NOTE: reads every chunk's key table so only once they're intact
+		res = append(res, dictionary.Verify(chunks)...)
+	}
+	return res
+}
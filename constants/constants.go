@@ -1,14 +1,91 @@
 package constants
 
 // TODO: consider storing in chords.go
-// 16 for chord, 4 for offset, 4 for fileId, 1 for flags
-const ChordSize = 25
+// 16 for chord, 4 for offset, 4 for fileId, 4 for seqNum, 1 for flags
+const ChordSize = 29
+
+// 4 for offset, 4 for fileId, 4 for seqNum, 1 for lowest note, 1 for flags,
+// 1 for rank score (postings are compressed in chunks, see chunk/postings.go)
+const PostingSize = 15
+
+// bump whenever the layout of anything in the index dir changes
+const IndexFormatVersion = 10
 
 const PreferredChunkSize = 64 * 1024 * 1024
 
+// bytes of postings of a key before a new block is started, blocks only
+// start with a new file so they can be bigger
+const PostingBlockSize = 64 * 1024
+
+// chunks the server keeps open between searches, and the most their indexes
+// can take up in memory. Postings read by a search aren't part of it, a
+// search holds every posting of the keys it reads.
+const MaxOpenChunks = 64
+const MaxOpenChunkIndexMB = 256
+
+// most memory the server uses to remember where removed files are in the
+// postings of keys that were searched, until the index is compacted
+const MaxRemovedFilesCacheMB = 16
+
+// files in a page of search results, unless a limit up to MaxFilesPerPage
+// is asked for
+const FilesPerPage = 10
+const MaxFilesPerPage = 100
+
+// memory making chunks out of a bucket can use before spilling to disk
+const DefaultChunkMemoryMB = 512
+
 const AllChunksFilename = "allChunks.dat"
 
 const FileNumToNameFilename = "fileNumsToNames.dat"
 
+// every key in the index and the chunks it's in, sorted, with a sample of
+// every KeySampleRate keys
+const KeyDictionaryFilename = "keyDictionary.dat"
+const KeySampleFilename = "keySample.dat"
+const KeySampleRate = 128
+
+const FileKeysFilename = "fileKeys.dat"
+
+const ManifestFilename = "manifest.dat"
+
+const FileHashesFilename = "fileHashes.dat"
+
+const AlternatePathsFilename = "alternatePaths.dat"
+
+// progress of an index that's being built, kept so it can be resumed
+const BucketCheckpointFilename = "checkpoint.dat"
+const ChunkCheckpointFilename = "chunkCheckpoint.dat"
+
+// how often progress is saved while filling buckets and making chunks
+const FilesPerCheckpoint = 1000
+const BucketsPerCheckpoint = 16
+
+// files removed from the index that are still in chunks until compaction
+const DeletedFilesFilename = "deletedFiles.dat"
+
+// paths and hashes of every file that was removed, kept after compaction so
+// they aren't indexed again
+const RemovedFilesFilename = "removedFiles.dat"
+
+// buckets go in their own dir inside the index dir
+const BucketDirname = "buckets"
+
+// max number of distinct chord keys a single query chord can expand to
+const MaxKeysPerQuery = 500
+
+// max number of chords taken from a midi file sent as a query
+const MaxExampleChords = 8
+
+// biggest midi file that can be sent as a query
+const MaxExampleBytes = 1024 * 1024
+
+// edits allowed per chord when approximate searches don't specify any
+const DefaultMaxDistance = 1
+
+// chords with fewer or more notes than this aren't indexed
+const MinChordSize = 2
+const MaxChordSize = 16
+
 // minimum number microseconds of separation between chords to justify saving
 const NewChordThreshold = 10000
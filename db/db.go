@@ -4,22 +4,56 @@ import (
 	"strconv"
 
 	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
-func GetMidiMetadatas(filenames []string) map[string]model.MidiMetadata {
-	if len(filenames) > 10 {
-		panic("Not supposed to pass in more than 10 filenames!")
+const maxFilenamesPerBatch = 10
+
+func newClient() *dynamodb.DynamoDB {
+	endpoint := "http://localhost:8000"
+	session, err := session.NewSession(&aws.Config{
+		Region:   aws.String("localhost"),
+		Endpoint: &endpoint,
+	})
+	if err != nil {
+		panic("Could not create a new DynamoDB session because " + err.Error())
 	}
+	return dynamodb.New(session)
+}
 
+// GetAllMidiMetadatas is GetMidiMetadatas for any number of filenames
+func GetAllMidiMetadatas(filenames []string) map[string]model.MidiMetadata {
 	res := make(map[string]model.MidiMetadata)
-
 	if len(filenames) == 0 {
 		return res
 	}
+	client := newClient()
+	for i := 0; i < len(filenames); i += maxFilenamesPerBatch {
+		end := util.Min(len(filenames), i+maxFilenamesPerBatch)
+		for filename, metadata := range getMidiMetadatas(client, filenames[i:end]) {
+			res[filename] = metadata
+		}
+	}
+	return res
+}
+
+func GetMidiMetadatas(filenames []string) map[string]model.MidiMetadata {
+	if len(filenames) == 0 {
+		return make(map[string]model.MidiMetadata)
+	}
+	return getMidiMetadatas(newClient(), filenames)
+}
+
+func getMidiMetadatas(client *dynamodb.DynamoDB, filenames []string) map[string]model.MidiMetadata {
+	if len(filenames) > maxFilenamesPerBatch {
+		panic("Not supposed to pass in more than 10 filenames!")
+	}
+
+	res := make(map[string]model.MidiMetadata)
 
 	var keys []map[string]*dynamodb.AttributeValue
 	for _, filename := range filenames {
@@ -30,16 +64,6 @@ func GetMidiMetadatas(filenames []string) map[string]model.MidiMetadata {
 		keys = append(keys, key)
 	}
 
-	endpoint := "http://localhost:8000"
-	session, err := session.NewSession(&aws.Config{
-		Region:   aws.String("localhost"),
-		Endpoint: &endpoint,
-	})
-	if err != nil {
-		panic("Could not create a new DynamoDB session because " + err.Error())
-	}
-
-	client := dynamodb.New(session)
 	input := &dynamodb.BatchGetItemInput{
 		RequestItems: map[string]*dynamodb.KeysAndAttributes{
 			"harmondex-metadata": {Keys: keys},
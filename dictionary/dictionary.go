@@ -0,0 +1,335 @@
+package dictionary
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jsphweid/harmondex/chunk"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"golang.org/x/exp/slices"
+)
+
+// The key dictionary has a record for every key in the index, sorted by key.
+// A record is the length of the key (uvarint), the key, the number of chunks
+// it's in (uvarint) and then the chunk (uvarint) and entry (uvarint) of
+// every model.KeyLocation, in chunk order. Every constants.KeySampleRate
+// keys are saved to the key sample with where their record starts so only
+// the records after the closest sampled key have to be read. The sample also
+// has the chunks the dictionary was made from so a dictionary that's out of
+// date with allChunks.dat, like after a crash, isn't used.
+
+const readerBufferSize = 4 * 1024
+
+// Dictionary is an open key dictionary, which can be read by any number of
+// searches at once
+type Dictionary struct {
+	f      *os.File
+	size   int64
+	sample []model.SampledKey
+}
+
+type nextKey struct {
+	key   string
+	chunk int
+}
+
+type nextKeyHeap []nextKey
+
+func (h nextKeyHeap) Len() int { return len(h) }
+func (h nextKeyHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key < h[j].key
+	}
+	return h[i].chunk < h[j].chunk
+}
+func (h nextKeyHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *nextKeyHeap) Push(x any)   { *h = append(*h, x.(nextKey)) }
+func (h *nextKeyHeap) Pop() any {
+	old := *h
+	res := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return res
+}
+
+func encodeRecord(key string, locations []model.KeyLocation) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	var res []byte
+	putUvarint := func(x uint64) {
+		res = append(res, buf[:binary.PutUvarint(buf[:], x)]...)
+	}
+	putUvarint(uint64(len(key)))
+	res = append(res, key...)
+	putUvarint(uint64(len(locations)))
+	for _, location := range locations {
+		putUvarint(uint64(location.Chunk))
+		putUvarint(uint64(location.Entry))
+	}
+	return res
+}
+
+func chunkFilenames(chunks []model.ChunkOverview) []string {
+	var res []string
+	for _, c := range chunks {
+		res = append(res, c.Filename)
+	}
+	return res
+}
+
+// Write makes the dictionary of every key in chunks, which have to be in the
+// same order as they're saved in allChunks.dat. It's written before
+// allChunks.dat so a crash in between leaves the index as it was besides
+// the dictionary, which Open then refuses.
+func Write(chunks []model.ChunkOverview) {
+	tables := make([]chunk.KeyTable, len(chunks))
+	for i, c := range chunks {
+		f := util.OpenFileOrPanic(filepath.Join(util.GetIndexDir(), c.Filename))
+		tables[i], _ = chunk.ReadKeyTableOrPanic(f)
+		f.Close()
+	}
+
+	// NOTE: written next to it first so a crash never leaves half of one
+	tmp := util.GetKeyDictionaryPath() + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		panic("Could not create key dictionary: " + err.Error())
+	}
+	defer f.Close()
+	writer := bufio.NewWriter(f)
+
+	// NOTE: the key tables are sorted so they're merged like sorted runs
+	var next nextKeyHeap
+	positions := make([]int, len(tables))
+	for i, t := range tables {
+		if t.Len() > 0 {
+			next = append(next, nextKey{t.Key(0), i})
+		}
+	}
+	heap.Init(&next)
+
+	var sample []model.SampledKey
+	var offset int64
+	numKeys := 0
+	for len(next) > 0 {
+		key := next[0].key
+		var locations []model.KeyLocation
+		for len(next) > 0 && next[0].key == key {
+			i := next[0].chunk
+			locations = append(locations, model.KeyLocation{Chunk: uint32(i), Entry: uint32(positions[i])})
+			positions[i] += 1
+			if positions[i] < tables[i].Len() {
+				next[0].key = tables[i].Key(positions[i])
+				heap.Fix(&next, 0)
+			} else {
+				heap.Pop(&next)
+			}
+		}
+
+		if numKeys%constants.KeySampleRate == 0 {
+			sample = append(sample, model.SampledKey{Key: key, Offset: offset})
+		}
+		record := encodeRecord(key, locations)
+		if _, err := writer.Write(record); err != nil {
+			panic("Could not write key dictionary: " + err.Error())
+		}
+		offset += int64(len(record))
+		numKeys += 1
+	}
+
+	if err := writer.Flush(); err != nil {
+		panic("Could not write key dictionary: " + err.Error())
+	}
+	if err := f.Close(); err != nil {
+		panic("Could not write key dictionary: " + err.Error())
+	}
+	if err := os.Rename(tmp, util.GetKeyDictionaryPath()); err != nil {
+		panic("Could not replace key dictionary: " + err.Error())
+	}
+	util.ReplaceBinary(util.GetKeySamplePath(), model.KeySample{
+		Keys:           sample,
+		Chunks:         chunkFilenames(chunks),
+		DictionarySize: offset,
+	})
+}
+
+// Open opens the dictionary of chunks, which have to be the chunks it was
+// made from in the same order
+func Open(chunks []model.ChunkOverview) *Dictionary {
+	sample := util.ReadBinaryOrPanic[model.KeySample](util.GetKeySamplePath())
+	if !slices.Equal(sample.Chunks, chunkFilenames(chunks)) {
+		panic("Key dictionary was made from other chunks, the last index or compact has to be run again")
+	}
+
+	f := util.OpenFileOrPanic(util.GetKeyDictionaryPath())
+	stats, err := f.Stat()
+	if err != nil {
+		panic("Could not get key dictionary stats: " + err.Error())
+	}
+	if stats.Size() != sample.DictionarySize {
+		f.Close()
+		panic("Key sample is of another key dictionary, the last index or compact has to be run again")
+	}
+	return &Dictionary{
+		f:      f,
+		size:   stats.Size(),
+		sample: sample.Keys,
+	}
+}
+
+func (d *Dictionary) Close() {
+	d.f.Close()
+}
+
+// readRecords calls fn with every record from start up to end in order until
+// fn returns false
+func (d *Dictionary) readRecords(start int64, end int64, fn func(key string, locations []model.KeyLocation) bool) {
+	reader := bufio.NewReaderSize(io.NewSectionReader(d.f, start, end-start), readerBufferSize)
+	readUvarint := func() uint64 {
+		x, err := binary.ReadUvarint(reader)
+		if err != nil {
+			panic("Could not read key dictionary: " + err.Error())
+		}
+		return x
+	}
+	for {
+		if _, err := reader.Peek(1); err == io.EOF {
+			return
+		}
+		keyBuf := make([]byte, readUvarint())
+		if _, err := io.ReadFull(reader, keyBuf); err != nil {
+			panic("Could not read key dictionary: " + err.Error())
+		}
+		locations := make([]model.KeyLocation, readUvarint())
+		for i := range locations {
+			locations[i].Chunk = uint32(readUvarint())
+			locations[i].Entry = uint32(readUvarint())
+		}
+		if !fn(string(keyBuf), locations) {
+			return
+		}
+	}
+}
+
+// findSample returns the last sampled key that's not after key, or the
+// first one if they're all after it
+func (d *Dictionary) findSample(key string) int {
+	i := sort.Search(len(d.sample), func(i int) bool {
+		return d.sample[i].Key > key
+	})
+	return util.Max(i-1, 0)
+}
+
+// Find returns where the key is in the chunks, false if it's not in any
+func (d *Dictionary) Find(key string) ([]model.KeyLocation, bool) {
+	var res []model.KeyLocation
+	if len(d.sample) == 0 {
+		return res, false
+	}
+	i := d.findSample(key)
+	end := d.size
+	if i+1 < len(d.sample) {
+		end = d.sample[i+1].Offset
+	}
+	found := false
+	d.readRecords(d.sample[i].Offset, end, func(k string, locations []model.KeyLocation) bool {
+		if k == key {
+			res, found = locations, true
+		}
+		return k < key
+	})
+	return res, found
+}
+
+// ForEachInRange calls fn with every key from start up to but not including
+// end in order, or every key after start if end is empty, until fn returns
+// false
+func (d *Dictionary) ForEachInRange(start string, end string, fn func(key string, locations []model.KeyLocation) bool) {
+	if len(d.sample) == 0 {
+		return
+	}
+	d.readRecords(d.sample[d.findSample(start)].Offset, d.size, func(key string, locations []model.KeyLocation) bool {
+		if key < start {
+			return true
+		}
+		if end != "" && key >= end {
+			return false
+		}
+		return fn(key, locations)
+	})
+}
+
+// ForEachWithPrefix calls fn with every key that starts with prefix in order
+// until fn returns false
+func (d *Dictionary) ForEachWithPrefix(prefix string, fn func(key string, locations []model.KeyLocation) bool) {
+	d.ForEachInRange(prefix, "", func(key string, locations []model.KeyLocation) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		return fn(key, locations)
+	})
+}
+
+// Verify checks that the dictionary has every key of chunks and nothing else,
+// returning everything that's wrong with it
+func Verify(chunks []model.ChunkOverview) []error {
+	var res []error
+	fail := func(format string, a ...any) {
+		res = append(res, fmt.Errorf(constants.KeyDictionaryFilename+": "+format, a...))
+	}
+
+	var d *Dictionary
+	if err := catch(func() { d = Open(chunks) }); err != nil {
+		fail("could not open: %v", err)
+		return res
+	}
+	defer d.Close()
+
+	numKeys := 0
+	tables := make([]chunk.KeyTable, len(chunks))
+	for i, c := range chunks {
+		f := util.OpenFileOrPanic(filepath.Join(util.GetIndexDir(), c.Filename))
+		tables[i], _ = chunk.ReadKeyTableOrPanic(f)
+		f.Close()
+		numKeys += tables[i].Len()
+	}
+
+	numLocations := 0
+	err := catch(func() {
+		d.ForEachInRange("", "", func(key string, locations []model.KeyLocation) bool {
+			for _, location := range locations {
+				numLocations += 1
+				if int(location.Chunk) >= len(tables) || int(location.Entry) >= tables[location.Chunk].Len() {
+					fail("%v is at entry %v of chunk %v, which doesn't exist", key, location.Entry, location.Chunk)
+				} else if other := tables[location.Chunk].Key(int(location.Entry)); other != key {
+					fail("%v is at entry %v of chunk %v, which is %v", key, location.Entry, location.Chunk, other)
+				}
+			}
+			return true
+		})
+	})
+	if err != nil {
+		fail("could not read: %v", err)
+	} else if numLocations != numKeys {
+		fail("has %v keys of chunks but the chunks have %v", numLocations, numKeys)
+	}
+	return res
+}
+
+// catch returns what fn panicked with as an error
+func catch(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	fn()
+	return nil
+}
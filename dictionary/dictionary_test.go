@@ -0,0 +1,130 @@
+package dictionary
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jsphweid/harmondex/chunk"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestChunk(sortedKeys []string) model.ChunkOverview {
+	posting := make([]byte, constants.PostingSize)
+	binary.LittleEndian.PutUint32(posting[4:8], 1)
+	keyToPostings := make(map[string][]byte)
+	for _, key := range sortedKeys {
+		keyToPostings[key] = posting
+	}
+	return chunk.Write(sortedKeys, keyToPostings)
+}
+
+type foundKey struct {
+	key       string
+	locations []model.KeyLocation
+}
+
+func collect(res *[]foundKey) func(key string, locations []model.KeyLocation) bool {
+	return func(key string, locations []model.KeyLocation) bool {
+		*res = append(*res, foundKey{key, locations})
+		return true
+	}
+}
+
+func TestFindsKeysAndTheirChunks(t *testing.T) {
+	os.Setenv("INDEX_PATH", t.TempDir())
+	assert := assert.New(t)
+
+	// enough keys to need more than one sampled key
+	var many []string
+	for i := 0; i < constants.KeySampleRate*3; i++ {
+		many = append(many, fmt.Sprintf("p:%04d", i))
+	}
+	chunks := []model.ChunkOverview{
+		// "100-..." sorts before "60-..." so this chunk's range covers
+		// "60-64-67" without having it
+		writeTestChunk([]string{"100-104-107", "72-76-79"}),
+		writeTestChunk(append([]string{"60-64-67", "72-76-79"}, many...)),
+		// like a delta chunk from incremental indexing
+		writeTestChunk([]string{"60-64-67", "t:0-4-7"}),
+	}
+	Write(chunks)
+	d := Open(chunks)
+	defer d.Close()
+
+	locations, ok := d.Find("60-64-67")
+	assert.True(ok)
+	assert.Equal([]model.KeyLocation{{Chunk: 1, Entry: 0}, {Chunk: 2, Entry: 0}}, locations)
+
+	locations, ok = d.Find("72-76-79")
+	assert.True(ok)
+	assert.Equal([]model.KeyLocation{{Chunk: 0, Entry: 1}, {Chunk: 1, Entry: 1}}, locations)
+
+	for i, key := range many {
+		locations, ok = d.Find(key)
+		assert.True(ok, key)
+		assert.Equal([]model.KeyLocation{{Chunk: 1, Entry: uint32(i + 2)}}, locations)
+	}
+
+	for _, key := range []string{"", "0", "60-64", "60-64-68", "p:0127x", "t:0-4-7-9", "z"} {
+		_, ok = d.Find(key)
+		assert.False(ok, key)
+	}
+
+	var inRange []foundKey
+	d.ForEachInRange("6", "p:", collect(&inRange))
+	assert.Equal([]foundKey{
+		{"60-64-67", []model.KeyLocation{{Chunk: 1, Entry: 0}, {Chunk: 2, Entry: 0}}},
+		{"72-76-79", []model.KeyLocation{{Chunk: 0, Entry: 1}, {Chunk: 1, Entry: 1}}},
+	}, inRange)
+
+	var withPrefix []foundKey
+	d.ForEachWithPrefix("p:02", collect(&withPrefix))
+	assert.Len(withPrefix, 100)
+	assert.Equal("p:0200", withPrefix[0].key)
+	assert.Equal("p:0299", withPrefix[99].key)
+
+	var untilEnd []foundKey
+	d.ForEachInRange("p:0383x", "", collect(&untilEnd))
+	assert.Equal([]foundKey{
+		{"t:0-4-7", []model.KeyLocation{{Chunk: 2, Entry: 1}}},
+	}, untilEnd)
+
+	numVisited := 0
+	d.ForEachInRange("", "", func(key string, locations []model.KeyLocation) bool {
+		numVisited += 1
+		return numVisited < 5
+	})
+	assert.Equal(5, numVisited)
+
+	assert.Empty(Verify(chunks))
+	assert.NotEmpty(Verify(chunks[:2]))
+}
+
+func TestOnlyOpensForTheChunksItWasMadeFrom(t *testing.T) {
+	os.Setenv("INDEX_PATH", t.TempDir())
+	assert := assert.New(t)
+
+	chunks := []model.ChunkOverview{
+		writeTestChunk([]string{"60-64-67"}),
+		writeTestChunk([]string{"72-76-79"}),
+	}
+	Write(chunks)
+	Open(chunks).Close()
+
+	// like allChunks.dat after a compact that crashed before the dictionary
+	// was written
+	assert.Panics(func() { Open(chunks[1:]) })
+	assert.Panics(func() { Open([]model.ChunkOverview{chunks[1], chunks[0]}) })
+
+	// like a sample that's out of date with the dictionary
+	f, err := os.OpenFile(util.GetKeyDictionaryPath(), os.O_APPEND|os.O_WRONLY, 0)
+	assert.Nil(err)
+	f.Write([]byte{0})
+	f.Close()
+	assert.Panics(func() { Open(chunks) })
+}
@@ -0,0 +1,102 @@
+//go:build e2e
+// +build e2e
+
+package e2e_test
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jsphweid/harmondex/bucket"
+	"github.com/jsphweid/harmondex/chunk"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/file"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func readAllPostings(chunks []model.ChunkOverview) map[string][]byte {
+	res := make(map[string][]byte)
+	for _, c := range chunks {
+		f := util.OpenFileOrPanic(filepath.Join(util.GetIndexDir(), c.Filename))
+		t, _ := chunk.ReadKeyTableOrPanic(f)
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			panic(err.Error())
+		}
+		for i := 0; i < t.Len(); i++ {
+			p := t.Entry(i)
+			postings, err := chunk.DecodePostings(data[p.Start:p.End], 0)
+			if err != nil {
+				panic(err.Error())
+			}
+			res[t.Key(i)] = postings
+		}
+	}
+	return res
+}
+
+// test_chunks.json has the chunks test_midis made before chunks were made
+// with an external merge, with the postings of every key
+type goldenChunks struct {
+	Chunks []struct {
+		Start string
+		End   string
+	}
+	Postings map[string][]byte
+}
+
+func assertChunksAreGolden(assert *assert.Assertions, chunks []model.ChunkOverview) {
+	b, err := ioutil.ReadFile("./test_chunks.json")
+	assert.Nil(err)
+	var golden goldenChunks
+	assert.Nil(json.Unmarshal(b, &golden))
+
+	assert.Equal(len(golden.Chunks), len(chunks))
+	for i := range golden.Chunks {
+		assert.Equal(golden.Chunks[i].Start, chunks[i].Start)
+		assert.Equal(golden.Chunks[i].End, chunks[i].End)
+	}
+	assert.Equal(golden.Postings, readAllPostings(chunks))
+}
+
+func TestChunkMemoryBudgetE2E(t *testing.T) {
+	os.Setenv("INDEX_PATH", "./out_chunk_memory")
+	t.Cleanup(func() {
+		os.RemoveAll("./out_chunk_memory")
+		os.Setenv("INDEX_PATH", "./out")
+	})
+	assert := assert.New(t)
+
+	util.RecreateOutputDir()
+	fileNumMap := file.CreateFileNumMap(util.GatherAllMidiPaths(0))
+	bucket.ProcessAllMidiFiles(fileNumMap, file.NewIndexedFiles(), 1, false)
+
+	inMemory := chunk.CreateAll(constants.DefaultChunkMemoryMB * 1024 * 1024)
+	expected := readAllPostings(inMemory)
+	assert.NotEmpty(expected)
+	assert.Equal(constants.PostingSize*2, len(expected["60-64-67"]))
+	assertChunksAreGolden(assert, inMemory)
+
+	// every chord gets its own run
+	chunk.DeleteCheckpoint()
+	spilled := chunk.CreateAll(1)
+	assert.Equal(len(inMemory), len(spilled))
+	for i := range inMemory {
+		assert.Equal(inMemory[i].Start, spilled[i].Start)
+		assert.Equal(inMemory[i].End, spilled[i].End)
+	}
+	assert.Equal(expected, readAllPostings(spilled))
+	assertChunksAreGolden(assert, spilled)
+
+	// temp files are cleaned up
+	tmps, err := filepath.Glob(filepath.Join(util.GetIndexDir(), "*.tmp"))
+	assert.Nil(err)
+	assert.Empty(tmps)
+}
@@ -0,0 +1,100 @@
+//go:build e2e
+// +build e2e
+
+package e2e_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jsphweid/harmondex/bucket"
+	"github.com/jsphweid/harmondex/cmd"
+	"github.com/jsphweid/harmondex/file"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// test_midis_dupes has a/song.mid, a byte for byte copy of it at b/song.mid,
+// a copy with a different track name at c/renamed.mid and d/other.mid
+func TestDedupE2E(t *testing.T) {
+	os.Setenv("INDEX_PATH", "./out_dedup")
+	os.Setenv("MEDIA_PATH", "./test_midis_dupes")
+	t.Cleanup(func() {
+		os.RemoveAll("./out_dedup")
+		os.Setenv("INDEX_PATH", "./out")
+		os.Setenv("MEDIA_PATH", "./test_midis")
+		cmd.LoadServeFiles()
+	})
+	assert := assert.New(t)
+
+	t.Run("same content", func(t *testing.T) {
+		cmd.Index(0)
+		cmd.LoadServeFiles()
+
+		cChord := searchOrPanic(model.Notes{60, 64, 67})
+		assert.Equal(2, cChord.NumFiles)
+		assert.Equal(uint32(1), cChord.Results[0].FileId)
+		assert.Equal([]string{filepath.Join("b", "song.mid")}, cChord.Results[0].AlternatePaths)
+		assert.Equal(uint32(3), cChord.Results[1].FileId)
+		assert.Empty(cChord.Results[1].AlternatePaths)
+	})
+
+	t.Run("same notes", func(t *testing.T) {
+		util.RecreateOutputDir()
+		fileNumMap := file.CreateFileNumMap(util.GatherAllMidiPaths(0))
+		files := bucket.ProcessAllMidiFiles(fileNumMap, file.NewIndexedFiles(), 1, true)
+		assert.Equal(model.FileNumToAlternatePaths{
+			1: {filepath.Join("b", "song.mid"), filepath.Join("c", "renamed.mid")},
+		}, files.AlternatePaths)
+		assert.Len(files.Keys, 2)
+	})
+
+	t.Run("new copies of indexed files", func(t *testing.T) {
+		os.Setenv("MEDIA_PATH", "./test_midis_dupes/a")
+		cmd.Index(0)
+		os.Setenv("MEDIA_PATH", "./test_midis_dupes")
+		// a/song.mid is now song.mid so the new a/song.mid is a copy of it
+		cmd.IndexIncremental(0)
+		cmd.LoadServeFiles()
+
+		cChord := searchOrPanic(model.Notes{60, 64, 67})
+		assert.Equal(2, cChord.NumFiles)
+		assert.Equal([]string{filepath.Join("a", "song.mid"), filepath.Join("b", "song.mid")}, cChord.Results[0].AlternatePaths)
+	})
+
+	t.Run("removing a copy", func(t *testing.T) {
+		cmd.Index(0)
+		assert.Equal([]uint32{2}, cmd.Remove(filepath.Join("b", "song.mid")))
+		cmd.LoadServeFiles()
+
+		cChord := searchOrPanic(model.Notes{60, 64, 67})
+		assert.Equal(2, cChord.NumFiles)
+		assert.Equal(uint32(1), cChord.Results[0].FileId)
+		assert.Empty(cChord.Results[0].AlternatePaths)
+	})
+
+	t.Run("removing the indexed file of copies", func(t *testing.T) {
+		cmd.Index(0)
+		assert.Equal([]uint32{1}, cmd.Remove(filepath.Join("a", "song.mid")))
+		cmd.LoadServeFiles()
+
+		assertCopyIsLeft := func() {
+			cChord := searchOrPanic(model.Notes{60, 64, 67})
+			assert.Equal(2, cChord.NumFiles)
+			assert.Equal(uint32(1), cChord.Results[0].FileId)
+			assert.Empty(cChord.Results[0].AlternatePaths)
+			fileNumMap := util.ReadBinaryOrPanic[model.FileNumToMidiPath](util.GetFileNumToNamePath())
+			assert.Equal(filepath.Join("b", "song.mid"), fileNumMap[1])
+		}
+		assertCopyIsLeft()
+		cmd.Compact()
+		cmd.LoadServeFiles()
+		assertCopyIsLeft()
+		// a/song.mid isn't back as a copy
+		cmd.IndexIncremental(0)
+		cmd.LoadServeFiles()
+		assertCopyIsLeft()
+	})
+}
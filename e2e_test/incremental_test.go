@@ -0,0 +1,70 @@
+//go:build e2e
+// +build e2e
+
+package e2e_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jsphweid/harmondex/cmd"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func searchOrPanic(notes model.Notes) model.SearchResponse {
+	req := httptest.NewRequest(http.MethodPost, "/search", createSearchReqBody(notes))
+	w := httptest.NewRecorder()
+	cmd.HandleSearch(w, req)
+
+	var searchResponse model.SearchResponse
+	err := json.NewDecoder(w.Result().Body).Decode(&searchResponse)
+	if err != nil {
+		panic(err.Error())
+	}
+	return searchResponse
+}
+
+func TestIncrementalIndexE2E(t *testing.T) {
+	os.Setenv("INDEX_PATH", "./out_incremental")
+	t.Cleanup(func() {
+		os.RemoveAll("./out_incremental")
+		os.Setenv("INDEX_PATH", "./out")
+		cmd.LoadServeFiles()
+	})
+
+	// only simple.mid, then everything else
+	cmd.Index(1)
+	assert := assert.New(t)
+
+	// a delta chunk of an incremental index that crashed
+	chunks := util.ReadBinaryOrPanic[[]model.ChunkOverview](util.GetAllChunksPath())
+	orphan := filepath.Join(util.GetIndexDir(), "00000000-0000-0000-0000-000000000000.dat")
+	b, err := ioutil.ReadFile(filepath.Join(util.GetIndexDir(), chunks[0].Filename))
+	assert.Nil(err)
+	assert.Nil(ioutil.WriteFile(orphan, b, 0777))
+
+	cmd.IndexIncremental(0)
+	cmd.LoadServeFiles()
+	assert.False(util.Exists(orphan))
+
+	cChord := searchOrPanic(model.Notes{60, 64, 67})
+	assert.Equal(1, cChord.NumFiles)
+	assert.Equal(uint32(1), cChord.Results[0].FileId)
+
+	dChord := searchOrPanic(model.Notes{62, 66, 69})
+	assert.Equal(1, dChord.NumFiles)
+	assert.Equal(uint32(2), dChord.Results[0].FileId)
+	assert.Equal([]uint32{0, 960}, dChord.Results[0].AbsTickOffsets)
+
+	// nothing new so nothing changes
+	cmd.IndexIncremental(0)
+	cmd.LoadServeFiles()
+	assert.Equal(dChord, searchOrPanic(model.Notes{62, 66, 69}))
+}
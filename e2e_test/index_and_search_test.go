@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/jsphweid/harmondex/cmd"
+	"github.com/jsphweid/harmondex/constants"
 	"github.com/jsphweid/harmondex/model"
 	"github.com/stretchr/testify/assert"
 )
@@ -32,7 +33,14 @@ func TestMain(m *testing.M) {
 }
 
 func createSearchReqBody(notes model.Notes) io.Reader {
-	sr := model.SearchRequestBody{Chords: [][]uint8{notes}}
+	return createProgressionReqBody([]model.Notes{notes})
+}
+
+func createProgressionReqBody(chords []model.Notes) io.Reader {
+	return marshalReqBody(model.SearchRequestBody{Chords: chords})
+}
+
+func marshalReqBody(sr model.SearchRequestBody) io.Reader {
 	data, err := json.Marshal(sr)
 	if err != nil {
 		panic(err.Error())
@@ -99,3 +107,538 @@ func TestBasicFChordE2E(t *testing.T) {
 		}},
 	}, searchResponse)
 }
+
+func TestProgressionE2E(t *testing.T) {
+	body := createProgressionReqBody([]model.Notes{{60, 64, 67}, {60, 65, 69}})
+	req := httptest.NewRequest(http.MethodPost, "/search", body)
+	w := httptest.NewRecorder()
+	cmd.HandleSearch(w, req)
+
+	resp := w.Result()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(resp.StatusCode, 200)
+
+	var searchResponse model.SearchResponse
+	err := json.Unmarshal(respBody, &searchResponse)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	assert.Equal(model.SearchResponse{
+		Start:      0,
+		NumMatches: 1,
+		NumFiles:   1,
+		Results: []model.SearchResultV2{{
+			FileId:         1,
+			AbsTickOffsets: []uint32{0},
+			MidiMetadata:   nil,
+		}},
+	}, searchResponse)
+}
+
+func TestProgressionMustBeConsecutiveE2E(t *testing.T) {
+	cases := map[string][]model.Notes{
+		"repeated chord": {{60, 65, 69}, {60, 65, 69}},
+		"not contiguous": {{60, 64, 67}, {60, 64, 67}},
+		"too long":       {{60, 64, 67}, {60, 65, 69}, {60, 64, 67}, {60, 65, 69}},
+	}
+
+	for name, chords := range cases {
+		t.Run(name, func(t *testing.T) {
+			body := createProgressionReqBody(chords)
+			req := httptest.NewRequest(http.MethodPost, "/search", body)
+			w := httptest.NewRecorder()
+			cmd.HandleSearch(w, req)
+
+			var searchResponse model.SearchResponse
+			err := json.NewDecoder(w.Result().Body).Decode(&searchResponse)
+			if err != nil {
+				panic(err.Error())
+			}
+
+			assert := assert.New(t)
+			assert.Equal(0, searchResponse.NumMatches)
+			assert.Equal(0, searchResponse.NumFiles)
+		})
+	}
+}
+
+func TestTransposedChordE2E(t *testing.T) {
+	body := marshalReqBody(model.SearchRequestBody{
+		Chords: []model.Notes{{62, 66, 69}},
+		Mode:   model.TransposedSearch,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/search", body)
+	w := httptest.NewRecorder()
+	cmd.HandleSearch(w, req)
+
+	resp := w.Result()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(resp.StatusCode, 200)
+
+	var searchResponse model.SearchResponse
+	err := json.Unmarshal(respBody, &searchResponse)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	assert.Equal(model.SearchResponse{
+		Start:      0,
+		NumMatches: 2,
+		NumFiles:   1,
+		Results: []model.SearchResultV2{{
+			FileId:         1,
+			AbsTickOffsets: []uint32{0, 960},
+			Transpositions: []int8{-2, -2},
+			MidiMetadata:   nil,
+		}},
+	}, searchResponse)
+}
+
+func TestTransposedProgressionE2E(t *testing.T) {
+	cases := map[string]struct {
+		chords     []model.Notes
+		numMatches int
+	}{
+		"same transposition":      {[]model.Notes{{62, 66, 69}, {62, 67, 71}}, 1},
+		"different transposition": {[]model.Notes{{62, 66, 69}, {60, 65, 69}}, 0},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			body := marshalReqBody(model.SearchRequestBody{
+				Chords: c.chords,
+				Mode:   model.TransposedSearch,
+			})
+			req := httptest.NewRequest(http.MethodPost, "/search", body)
+			w := httptest.NewRecorder()
+			cmd.HandleSearch(w, req)
+
+			var searchResponse model.SearchResponse
+			err := json.NewDecoder(w.Result().Body).Decode(&searchResponse)
+			if err != nil {
+				panic(err.Error())
+			}
+
+			assert.Equal(t, c.numMatches, searchResponse.NumMatches)
+		})
+	}
+}
+
+func TestPitchClassChordE2E(t *testing.T) {
+	body := marshalReqBody(model.SearchRequestBody{
+		Chords: []model.Notes{{48, 52, 55, 64}},
+		Mode:   model.PitchClassSearch,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/search", body)
+	w := httptest.NewRecorder()
+	cmd.HandleSearch(w, req)
+
+	resp := w.Result()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(resp.StatusCode, 200)
+
+	var searchResponse model.SearchResponse
+	err := json.Unmarshal(respBody, &searchResponse)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	assert.Equal(model.SearchResponse{
+		Start:      0,
+		NumMatches: 2,
+		NumFiles:   1,
+		Results: []model.SearchResultV2{{
+			FileId:         1,
+			AbsTickOffsets: []uint32{0, 960},
+			MidiMetadata:   nil,
+		}},
+	}, searchResponse)
+}
+
+func TestContainsAndWithinE2E(t *testing.T) {
+	cases := map[string]struct {
+		notes      model.Notes
+		mode       model.SearchMode
+		numMatches int
+	}{
+		"contains fifth":          {model.Notes{60, 67}, model.ContainsSearch, 2},
+		"contains root":           {model.Notes{60}, model.ContainsSearch, 3},
+		"contains missing note":   {model.Notes{60, 70}, model.ContainsSearch, 0},
+		"within scale":            {model.Notes{60, 62, 64, 65, 67, 69}, model.WithinSearch, 3},
+		"within dominant seventh": {model.Notes{60, 64, 67, 70}, model.WithinSearch, 2},
+		"within too few notes":    {model.Notes{60, 64}, model.WithinSearch, 0},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			body := marshalReqBody(model.SearchRequestBody{
+				Chords: []model.Notes{c.notes},
+				Mode:   c.mode,
+			})
+			req := httptest.NewRequest(http.MethodPost, "/search", body)
+			w := httptest.NewRecorder()
+			cmd.HandleSearch(w, req)
+
+			var searchResponse model.SearchResponse
+			err := json.NewDecoder(w.Result().Body).Decode(&searchResponse)
+			if err != nil {
+				panic(err.Error())
+			}
+
+			assert.Equal(t, c.numMatches, searchResponse.NumMatches)
+		})
+	}
+}
+
+func TestFallsBackToApproximateE2E(t *testing.T) {
+	body := createSearchReqBody([]uint8{60, 64, 68})
+	req := httptest.NewRequest(http.MethodPost, "/search", body)
+	w := httptest.NewRecorder()
+	cmd.HandleSearch(w, req)
+
+	resp := w.Result()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(resp.StatusCode, 200)
+
+	var searchResponse model.SearchResponse
+	err := json.Unmarshal(respBody, &searchResponse)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	assert.Equal(model.SearchResponse{
+		Approximate: true,
+		Start:       0,
+		NumMatches:  2,
+		NumFiles:    1,
+		Results: []model.SearchResultV2{{
+			FileId:         1,
+			AbsTickOffsets: []uint32{0, 960},
+			Distances:      []int{1, 1},
+			MidiMetadata:   nil,
+		}},
+	}, searchResponse)
+}
+
+func TestApproximateRanksByDistanceE2E(t *testing.T) {
+	body := marshalReqBody(model.SearchRequestBody{
+		Chords:      []model.Notes{{60, 64, 67}},
+		Mode:        model.ApproximateSearch,
+		MaxDistance: 3,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/search", body)
+	w := httptest.NewRecorder()
+	cmd.HandleSearch(w, req)
+
+	resp := w.Result()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(resp.StatusCode, 200)
+
+	var searchResponse model.SearchResponse
+	err := json.Unmarshal(respBody, &searchResponse)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	assert.Equal(model.SearchResponse{
+		Approximate: true,
+		Start:       0,
+		NumMatches:  3,
+		NumFiles:    1,
+		Results: []model.SearchResultV2{{
+			FileId:         1,
+			AbsTickOffsets: []uint32{0, 960, 480},
+			Distances:      []int{0, 0, 3},
+			MidiMetadata:   nil,
+		}},
+	}, searchResponse)
+}
+
+func TestChordSymbolsE2E(t *testing.T) {
+	cases := map[string]struct {
+		symbols    []string
+		voicing    model.Voicing
+		numMatches int
+	}{
+		"exact voicing":              {[]string{"C"}, model.ExactVoicing, 2},
+		"exact voicing progression":  {[]string{"C", "F/C"}, model.ExactVoicing, 1},
+		"exact voicing wrong bass":   {[]string{"F"}, model.ExactVoicing, 0},
+		"any voicing":                {[]string{"F"}, model.AnyVoicing, 1},
+		"any voicing progression":    {[]string{"F", "C"}, model.AnyVoicing, 1},
+		"any voicing missing chords": {[]string{"G7"}, model.AnyVoicing, 0},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			body := marshalReqBody(model.SearchRequestBody{
+				Symbols: c.symbols,
+				Voicing: c.voicing,
+			})
+			req := httptest.NewRequest(http.MethodPost, "/search", body)
+			w := httptest.NewRecorder()
+			cmd.HandleSearch(w, req)
+
+			var searchResponse model.SearchResponse
+			err := json.NewDecoder(w.Result().Body).Decode(&searchResponse)
+			if err != nil {
+				panic(err.Error())
+			}
+
+			assert.Equal(t, c.numMatches, searchResponse.NumMatches)
+		})
+	}
+}
+
+func TestBadChordSymbolE2E(t *testing.T) {
+	body := marshalReqBody(model.SearchRequestBody{Symbols: []string{"Hmaj7"}})
+	req := httptest.NewRequest(http.MethodPost, "/search", body)
+	w := httptest.NewRecorder()
+	cmd.HandleSearch(w, req)
+
+	assert.Equal(t, 400, w.Result().StatusCode)
+}
+
+func TestNumeralProgressionE2E(t *testing.T) {
+	body := marshalReqBody(model.SearchRequestBody{Numerals: []string{"I", "IV"}})
+	req := httptest.NewRequest(http.MethodPost, "/search", body)
+	w := httptest.NewRecorder()
+	cmd.HandleSearch(w, req)
+
+	resp := w.Result()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(resp.StatusCode, 200)
+
+	var searchResponse model.SearchResponse
+	err := json.Unmarshal(respBody, &searchResponse)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	assert.Equal(model.SearchResponse{
+		Start:      0,
+		NumMatches: 1,
+		NumFiles:   1,
+		Results: []model.SearchResultV2{{
+			FileId:         1,
+			AbsTickOffsets: []uint32{0},
+			Key:            "C major",
+			MidiMetadata:   nil,
+		}},
+	}, searchResponse)
+}
+
+func TestNumeralProgressionMissesE2E(t *testing.T) {
+	cases := map[string]model.SearchRequestBody{
+		"wrong progression": {Numerals: []string{"V", "I"}},
+		"wrong key mode":    {Numerals: []string{"I", "IV"}, KeyMode: model.MinorKey},
+	}
+
+	for name, sr := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/search", marshalReqBody(sr))
+			w := httptest.NewRecorder()
+			cmd.HandleSearch(w, req)
+
+			var searchResponse model.SearchResponse
+			err := json.NewDecoder(w.Result().Body).Decode(&searchResponse)
+			if err != nil {
+				panic(err.Error())
+			}
+
+			assert.Equal(t, 0, searchResponse.NumMatches)
+		})
+	}
+}
+
+func TestMetadataOptionsE2E(t *testing.T) {
+	cases := map[string]struct {
+		sr         model.SearchRequestBody
+		numMatches int
+	}{
+		"filter drops files without metadata": {model.SearchRequestBody{
+			Chords: []model.Notes{{60, 64, 67}},
+			Filter: &model.MetadataFilter{MinYear: 1970, MaxYear: 1979},
+		}, 0},
+		"sort keeps files without metadata": {model.SearchRequestBody{
+			Chords: []model.Notes{{60, 64, 67}},
+			Sort:   "-year",
+		}, 2},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/search", marshalReqBody(c.sr))
+			w := httptest.NewRecorder()
+			cmd.HandleSearch(w, req)
+
+			var searchResponse model.SearchResponse
+			err := json.NewDecoder(w.Result().Body).Decode(&searchResponse)
+			if err != nil {
+				panic(err.Error())
+			}
+
+			assert.Equal(t, c.numMatches, searchResponse.NumMatches)
+		})
+	}
+}
+
+func TestUnknownSortE2E(t *testing.T) {
+	body := marshalReqBody(model.SearchRequestBody{
+		Chords: []model.Notes{{60, 64, 67}},
+		Sort:   "tempo",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/search", body)
+	w := httptest.NewRecorder()
+	cmd.HandleSearch(w, req)
+
+	assert.Equal(t, 400, w.Result().StatusCode)
+}
+
+func TestSearchByExampleE2E(t *testing.T) {
+	data, err := os.ReadFile("./test_midis/simple.mid")
+	if err != nil {
+		panic(err.Error())
+	}
+	req := httptest.NewRequest(http.MethodPost, "/search/midi?mode=transposed", bytes.NewReader(data))
+	w := httptest.NewRecorder()
+	cmd.HandleSearchByExample(w, req)
+
+	resp := w.Result()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(resp.StatusCode, 200)
+
+	var searchResponse model.SearchResponse
+	err = json.Unmarshal(respBody, &searchResponse)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	assert.Equal(model.SearchResponse{
+		Start:      0,
+		NumMatches: 1,
+		NumFiles:   1,
+		Results: []model.SearchResultV2{{
+			FileId:         1,
+			AbsTickOffsets: []uint32{0},
+			Transpositions: []int8{0},
+			MidiMetadata:   nil,
+		}},
+	}, searchResponse)
+}
+
+func TestSearchByExampleNotMidiE2E(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/search/midi", bytes.NewReader([]byte("not midi")))
+	w := httptest.NewRecorder()
+	cmd.HandleSearchByExample(w, req)
+
+	assert.Equal(t, 400, w.Result().StatusCode)
+}
+
+func TestSearchByExampleTooBigE2E(t *testing.T) {
+	body := make([]byte, constants.MaxExampleBytes+1)
+	req := httptest.NewRequest(http.MethodPost, "/search/midi", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	cmd.HandleSearchByExample(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Result().StatusCode)
+}
+
+func TestExplainE2E(t *testing.T) {
+	body := createSearchReqBody([]uint8{60, 65, 69})
+	req := httptest.NewRequest(http.MethodPost, "/search?explain=true", body)
+	w := httptest.NewRecorder()
+	cmd.HandleSearch(w, req)
+
+	resp := w.Result()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(resp.StatusCode, 200)
+
+	var searchResponse model.SearchResponse
+	err := json.Unmarshal(respBody, &searchResponse)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	assert.Equal(model.SearchResponse{
+		Start:      0,
+		NumMatches: 1,
+		NumFiles:   1,
+		Results: []model.SearchResultV2{{
+			FileId:         1,
+			AbsTickOffsets: []uint32{480},
+			Explanations: []model.HitExplanation{{
+				RankScore:             6,
+				FileHasMetadata:       false,
+				FormedByNoteOn:        true,
+				OldestEventWithin1Sec: true,
+			}},
+			MidiMetadata: nil,
+		}},
+	}, searchResponse)
+}
+
+func TestHitFiltersE2E(t *testing.T) {
+	cases := map[string]struct {
+		query      string
+		numMatches int
+		statusCode int
+	}{
+		"matching flag":       {"?formed_by_note_on=true", 2, 200},
+		"not matching flag":   {"?file_has_metadata=true", 0, 200},
+		"low min rank score":  {"?min_rank_score=6", 2, 200},
+		"high min rank score": {"?min_rank_score=7", 0, 200},
+		"bad flag":            {"?formed_by_note_on=maybe", 0, 400},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			body := createSearchReqBody([]uint8{60, 64, 67})
+			req := httptest.NewRequest(http.MethodPost, "/search"+c.query, body)
+			w := httptest.NewRecorder()
+			cmd.HandleSearch(w, req)
+
+			assert := assert.New(t)
+			assert.Equal(c.statusCode, w.Result().StatusCode)
+			if c.statusCode != 200 {
+				return
+			}
+
+			var searchResponse model.SearchResponse
+			err := json.NewDecoder(w.Result().Body).Decode(&searchResponse)
+			if err != nil {
+				panic(err.Error())
+			}
+			assert.Equal(c.numMatches, searchResponse.NumMatches)
+		})
+	}
+}
+
+func TestAnyVoicingWithModeE2E(t *testing.T) {
+	body := marshalReqBody(model.SearchRequestBody{
+		Symbols: []string{"C"},
+		Voicing: model.AnyVoicing,
+		Mode:    model.TransposedSearch,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/search", body)
+	w := httptest.NewRecorder()
+	cmd.HandleSearch(w, req)
+
+	assert.Equal(t, 400, w.Result().StatusCode)
+}
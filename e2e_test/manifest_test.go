@@ -0,0 +1,44 @@
+//go:build e2e
+// +build e2e
+
+package e2e_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jsphweid/harmondex/cmd"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/manifest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestE2E(t *testing.T) {
+	os.Setenv("INDEX_PATH", "./out_manifest")
+	t.Cleanup(func() {
+		os.RemoveAll("./out_manifest")
+		os.Setenv("INDEX_PATH", "./out")
+		cmd.LoadServeFiles()
+	})
+
+	cmd.Index(0)
+	assert := assert.New(t)
+	m, err := manifest.Read()
+	assert.Nil(err)
+	assert.Equal(uint32(constants.IndexFormatVersion), m.FormatVersion)
+	assert.Equal(2, m.NumFiles)
+	assert.Equal(int64(constants.NewChordThreshold), m.NewChordThreshold)
+	assert.True(manifest.HasSameBuildParameters(m))
+	assert.NotPanics(cmd.LoadServeFiles)
+
+	m.FormatVersion += 1
+	manifest.Write(m)
+	_, err = manifest.Read()
+	assert.NotNil(err)
+	assert.Panics(cmd.LoadServeFiles)
+
+	os.Remove("./out_manifest/manifest.dat")
+	_, err = manifest.Read()
+	assert.NotNil(err)
+	assert.Panics(cmd.LoadServeFiles)
+}
@@ -0,0 +1,64 @@
+//go:build e2e
+// +build e2e
+
+package e2e_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/jsphweid/harmondex/cmd"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func getFileOrPanic(id string) []byte {
+	req := httptest.NewRequest(http.MethodGet, "/file/"+id, nil)
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+	w := httptest.NewRecorder()
+	cmd.HandleGetFile(w, req)
+	bytes, err := ioutil.ReadAll(w.Result().Body)
+	if err != nil {
+		panic(err.Error())
+	}
+	return bytes
+}
+
+func TestNestedMidiFilesE2E(t *testing.T) {
+	os.Setenv("INDEX_PATH", "./out_nested")
+	os.Setenv("MEDIA_PATH", "./test_midis_nested")
+	t.Cleanup(func() {
+		os.RemoveAll("./out_nested")
+		os.Setenv("INDEX_PATH", "./out")
+		os.Setenv("MEDIA_PATH", "./test_midis")
+		cmd.LoadServeFiles()
+	})
+
+	// both files are called song.mid
+	cmd.Index(0)
+	cmd.LoadServeFiles()
+	assert := assert.New(t)
+
+	fileNumMap := util.ReadBinaryOrPanic[model.FileNumToMidiPath](util.GetFileNumToNamePath())
+	assert.Equal(model.FileNumToMidiPath{
+		1: filepath.Join("a", "song.mid"),
+		2: filepath.Join("b", "c", "song.mid"),
+	}, fileNumMap)
+
+	cChord := searchOrPanic(model.Notes{60, 64, 67})
+	assert.Equal(1, cChord.NumFiles)
+	assert.Equal(uint32(1), cChord.Results[0].FileId)
+	dChord := searchOrPanic(model.Notes{62, 66, 69})
+	assert.Equal(1, dChord.NumFiles)
+	assert.Equal(uint32(2), dChord.Results[0].FileId)
+
+	expected, err := ioutil.ReadFile("./test_midis_nested/b/c/song.mid")
+	assert.Nil(err)
+	assert.Equal(expected, getFileOrPanic("2"))
+}
@@ -0,0 +1,108 @@
+//go:build e2e
+// +build e2e
+
+package e2e_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/jsphweid/harmondex/cmd"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func searchPage(body model.SearchRequestBody, query url.Values) (model.SearchResponse, int) {
+	req := httptest.NewRequest(http.MethodPost, "/search?"+query.Encode(), marshalReqBody(body))
+	w := httptest.NewRecorder()
+	cmd.HandleSearch(w, req)
+
+	var searchResponse model.SearchResponse
+	if w.Result().StatusCode == 200 {
+		if err := json.NewDecoder(w.Result().Body).Decode(&searchResponse); err != nil {
+			panic(err.Error())
+		}
+	}
+	return searchResponse, w.Result().StatusCode
+}
+
+func TestCursorPaginationE2E(t *testing.T) {
+	os.Setenv("INDEX_PATH", "./out_pagination")
+	os.Setenv("MEDIA_PATH", "./test_midis_dupes")
+	t.Cleanup(func() {
+		os.RemoveAll("./out_pagination")
+		os.Setenv("INDEX_PATH", "./out")
+		os.Setenv("MEDIA_PATH", "./test_midis")
+		cmd.LoadServeFiles()
+	})
+	cmd.Index(0)
+	cmd.LoadServeFiles()
+	assert := assert.New(t)
+
+	// a/song.mid and d/other.mid have the chord, b/song.mid is a copy
+	for _, mode := range []model.SearchMode{model.ExactSearch, model.PitchClassSearch} {
+		body := model.SearchRequestBody{Chords: []model.Notes{{60, 64, 67}}, Mode: mode}
+		all, status := searchPage(body, url.Values{})
+		assert.Equal(200, status)
+		assert.Equal(2, all.NumFiles)
+		assert.Empty(all.NextCursor)
+
+		var results []model.SearchResultV2
+		query := url.Values{"limit": {"1"}}
+		for {
+			page, status := searchPage(body, query)
+			assert.Equal(200, status)
+			assert.Equal(all.NumFiles, page.NumFiles)
+			assert.Equal(all.NumMatches, page.NumMatches)
+			assert.Len(page.Results, 1)
+			results = append(results, page.Results...)
+			if page.NextCursor == "" {
+				break
+			}
+			query.Set("cursor", page.NextCursor)
+		}
+		assert.Equal(all.Results, results, mode)
+	}
+
+	body := model.SearchRequestBody{Chords: []model.Notes{{60, 64, 67}}}
+	first, _ := searchPage(body, url.Values{"limit": {"1"}})
+	assert.NotEmpty(first.NextCursor)
+
+	t.Run("cursor from another search", func(t *testing.T) {
+		other := model.SearchRequestBody{Chords: []model.Notes{{60, 64, 67}}, Mode: model.PitchClassSearch}
+		_, status := searchPage(other, url.Values{"cursor": {first.NextCursor}})
+		assert.Equal(400, status)
+	})
+
+	t.Run("bad cursor", func(t *testing.T) {
+		_, status := searchPage(body, url.Values{"cursor": {"not a cursor"}})
+		assert.Equal(400, status)
+	})
+
+	t.Run("bad limit", func(t *testing.T) {
+		_, status := searchPage(body, url.Values{"limit": {"0"}})
+		assert.Equal(400, status)
+	})
+
+	t.Run("limit is capped", func(t *testing.T) {
+		page, status := searchPage(body, url.Values{"limit": {"1000000"}})
+		assert.Equal(200, status)
+		assert.Len(page.Results, 2)
+	})
+
+	t.Run("cursor from before a compaction", func(t *testing.T) {
+		cmd.Remove("b/song.mid")
+		page, _ := searchPage(body, url.Values{"limit": {"1"}})
+		assert.NotEmpty(page.NextCursor)
+		cmd.Compact()
+		cmd.Remove("d/other.mid")
+
+		// NOTE: as many files are removed as when the cursor was made
+		_, status := searchPage(body, url.Values{"cursor": {page.NextCursor}})
+		assert.Equal(400, status)
+	})
+}
@@ -0,0 +1,116 @@
+//go:build e2e
+// +build e2e
+
+package e2e_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jsphweid/harmondex/cmd"
+	"github.com/jsphweid/harmondex/manifest"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveAndCompactE2E(t *testing.T) {
+	os.Setenv("INDEX_PATH", "./out_remove")
+	t.Cleanup(func() {
+		os.RemoveAll("./out_remove")
+		os.Setenv("INDEX_PATH", "./out")
+		cmd.LoadServeFiles()
+	})
+
+	cmd.Index(0)
+	cmd.LoadServeFiles()
+	assert := assert.New(t)
+	assert.Equal(1, searchOrPanic(model.Notes{62, 66, 69}).NumFiles)
+
+	// NOTE: the server reloads the index by itself
+	assert.Empty(cmd.Remove("some/dir/transposed.mid"))
+	assert.Equal([]uint32{2}, cmd.Remove("transposed.mid"))
+	absPath, err := filepath.Abs("./test_midis/transposed.mid")
+	assert.Nil(err)
+	assert.Empty(cmd.Remove(absPath))
+
+	assertOnlySimpleIsLeft := func() {
+		assert.Equal(0, searchOrPanic(model.Notes{62, 66, 69}).NumFiles)
+		cChord := searchOrPanic(model.Notes{60, 64, 67})
+		assert.Equal(1, cChord.NumFiles)
+		assert.Equal(uint32(1), cChord.Results[0].FileId)
+	}
+	assertOnlySimpleIsLeft()
+
+	oldChunks := util.ReadBinaryOrPanic[[]model.ChunkOverview](util.GetAllChunksPath())
+	cmd.Compact()
+	assertOnlySimpleIsLeft()
+	_, err = os.Stat("./out_remove/deletedFiles.dat")
+	assert.True(os.IsNotExist(err))
+
+	// a server that hasn't reloaded yet can still read the old chunks
+	for _, c := range oldChunks {
+		assert.True(util.Exists(filepath.Join(util.GetIndexDir(), c.Filename)))
+	}
+	chunks := make(map[string]bool)
+	for _, c := range util.ReadBinaryOrPanic[[]model.ChunkOverview](util.GetAllChunksPath()) {
+		chunks[c.Filename] = true
+	}
+	numReplaced := 0
+	cmd.Compact()
+	for _, c := range oldChunks {
+		if !chunks[c.Filename] {
+			numReplaced += 1
+			assert.False(util.Exists(filepath.Join(util.GetIndexDir(), c.Filename)))
+		}
+	}
+	assert.Greater(numReplaced, 0)
+	assertOnlySimpleIsLeft()
+}
+
+func copyMidi(t *testing.T, src string, dst string) {
+	b, err := ioutil.ReadFile(src)
+	assert.Nil(t, err)
+	assert.Nil(t, os.MkdirAll(filepath.Dir(dst), 0777))
+	assert.Nil(t, ioutil.WriteFile(dst, b, 0777))
+}
+
+func TestRemovedFilesAreNotIndexedAgainE2E(t *testing.T) {
+	mediaDir := t.TempDir()
+	os.Setenv("INDEX_PATH", "./out_remove")
+	os.Setenv("MEDIA_PATH", mediaDir)
+	t.Cleanup(func() {
+		os.RemoveAll("./out_remove")
+		os.Setenv("INDEX_PATH", "./out")
+		os.Setenv("MEDIA_PATH", "./test_midis")
+		cmd.LoadServeFiles()
+	})
+	assert := assert.New(t)
+
+	copyMidi(t, "./test_midis/simple.mid", filepath.Join(mediaDir, "simple.mid"))
+	copyMidi(t, "./test_midis/transposed.mid", filepath.Join(mediaDir, "transposed.mid"))
+	cmd.Index(0)
+	// NOTE: transposed.mid has the highest num
+	assert.Equal([]uint32{2}, cmd.Remove("transposed.mid"))
+	cmd.Compact()
+
+	copyMidi(t, "./test_midis/transposed.mid", filepath.Join(mediaDir, "copy", "transposed.mid"))
+	copyMidi(t, "./test_midis_dupes/d/other.mid", filepath.Join(mediaDir, "other.mid"))
+	cmd.IndexIncremental(0)
+	cmd.LoadServeFiles()
+
+	assert.Equal(0, searchOrPanic(model.Notes{62, 66, 69}).NumFiles)
+	fileNumMap := util.ReadBinaryOrPanic[model.FileNumToMidiPath](util.GetFileNumToNamePath())
+	assert.Equal("simple.mid", fileNumMap[1])
+	assert.NotContains(fileNumMap, uint32(2))
+	assert.Equal("other.mid", fileNumMap[4])
+	assert.NotContains(fileNumMap, "transposed.mid")
+	assert.Empty(util.ReadBinaryOrPanic[model.FileNumToAlternatePaths](util.GetAlternatePathsPath()))
+	assert.Equal(uint32(4), manifest.ReadOrPanic().MaxFileNum)
+
+	// nothing new so nothing changes
+	cmd.IndexIncremental(0)
+	assert.Equal(fileNumMap, util.ReadBinaryOrPanic[model.FileNumToMidiPath](util.GetFileNumToNamePath()))
+}
@@ -0,0 +1,88 @@
+//go:build e2e
+// +build e2e
+
+package e2e_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jsphweid/harmondex/bucket"
+	"github.com/jsphweid/harmondex/chunk"
+	"github.com/jsphweid/harmondex/cmd"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/file"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func startIndexForResume() model.FileNumToMidiPath {
+	util.RecreateOutputDir()
+	fileNumMap := file.CreateFileNumMap(util.GatherAllMidiPaths(0))
+	util.CreateBinary(util.GetFileNumToNamePath(), fileNumMap)
+	return fileNumMap
+}
+
+func assertResumedIndexIsComplete(assert *assert.Assertions) {
+	cmd.LoadServeFiles()
+	cChord := searchOrPanic(model.Notes{60, 64, 67})
+	assert.Equal(1, cChord.NumFiles)
+	assert.Equal(2, cChord.NumMatches)
+	dChord := searchOrPanic(model.Notes{62, 66, 69})
+	assert.Equal(1, dChord.NumFiles)
+	assert.Equal(2, dChord.NumMatches)
+	assert.False(util.Exists(util.GetChunkCheckpointPath()))
+	assert.Empty(cmd.Verify())
+}
+
+func TestResumeIndexE2E(t *testing.T) {
+	os.Setenv("INDEX_PATH", "./out_resume")
+	t.Cleanup(func() {
+		os.RemoveAll("./out_resume")
+		os.Setenv("INDEX_PATH", "./out")
+		cmd.LoadServeFiles()
+	})
+	assert := assert.New(t)
+
+	t.Run("crashed while filling buckets", func(t *testing.T) {
+		fileNumMap := startIndexForResume()
+		bucket.ProcessAllMidiFiles(model.FileNumToMidiPath{1: fileNumMap[1]}, file.NewIndexedFiles(), 1, false)
+
+		// a chord written after the checkpoint
+		bucketPath := filepath.Join(util.GetBucketDir(), "060.dat")
+		b, err := ioutil.ReadFile(bucketPath)
+		assert.Nil(err)
+		f, err := os.OpenFile(bucketPath, os.O_APPEND|os.O_WRONLY, 0777)
+		assert.Nil(err)
+		f.Write(b[:constants.ChordSize])
+		f.Close()
+
+		cmd.ResumeIndex()
+		assertResumedIndexIsComplete(assert)
+	})
+
+	t.Run("crashed while making chunks", func(t *testing.T) {
+		fileNumMap := startIndexForResume()
+		bucket.ProcessAllMidiFiles(fileNumMap, file.NewIndexedFiles(), 1, false)
+		chunks := chunk.CreateAll(constants.DefaultChunkMemoryMB * 1024 * 1024)
+
+		// a chunk written after the checkpoint
+		orphan := filepath.Join(util.GetIndexDir(), "00000000-0000-0000-0000-000000000000.dat")
+		b, err := ioutil.ReadFile(filepath.Join(util.GetIndexDir(), chunks[0].Filename))
+		assert.Nil(err)
+		assert.Nil(ioutil.WriteFile(orphan, b, 0777))
+
+		cmd.ResumeIndex()
+		assertResumedIndexIsComplete(assert)
+		assert.False(util.Exists(orphan))
+	})
+
+	// finished indexes aren't touched
+	before := searchOrPanic(model.Notes{60, 64, 67})
+	cmd.ResumeIndex()
+	cmd.LoadServeFiles()
+	assert.Equal(before, searchOrPanic(model.Notes{60, 64, 67}))
+}
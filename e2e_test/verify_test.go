@@ -0,0 +1,40 @@
+//go:build e2e
+// +build e2e
+
+package e2e_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jsphweid/harmondex/cmd"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyE2E(t *testing.T) {
+	os.Setenv("INDEX_PATH", "./out_verify")
+	t.Cleanup(func() {
+		os.RemoveAll("./out_verify")
+		os.Setenv("INDEX_PATH", "./out")
+	})
+
+	cmd.Index(0)
+	assert := assert.New(t)
+	assert.Empty(cmd.Verify())
+
+	chunks := util.ReadBinaryOrPanic[[]model.ChunkOverview](util.GetAllChunksPath())
+	path := filepath.Join("./out_verify", chunks[0].Filename)
+	info, err := os.Stat(path)
+	assert.Nil(err)
+
+	// cutting off the last posting breaks the checksum and the offsets
+	assert.Nil(os.Truncate(path, info.Size()-1))
+	assert.Len(cmd.Verify(), 2)
+
+	// cutting into the index means it can't even be parsed
+	assert.Nil(os.Truncate(path, 10))
+	assert.Len(cmd.Verify(), 2)
+}
@@ -0,0 +1,62 @@
+//go:build e2e
+// +build e2e
+
+package e2e_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jsphweid/harmondex/bucket"
+	"github.com/jsphweid/harmondex/file"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// fillBuckets puts the chords of every midi file in buckets with numWorkers
+// workers and returns the bytes of each bucket file and what was learned
+// about the files
+func fillBuckets(numWorkers int) (map[string][]byte, model.IndexedFiles) {
+	util.RecreateOutputDir()
+	fileNumMap := file.CreateFileNumMap(util.GatherAllMidiPaths(0))
+	files := bucket.ProcessAllMidiFiles(fileNumMap, file.NewIndexedFiles(), numWorkers, true)
+
+	entries, err := ioutil.ReadDir(util.GetBucketDir())
+	if err != nil {
+		panic(err.Error())
+	}
+	res := make(map[string][]byte)
+	for _, entry := range entries {
+		if bucket.IsBucketFile(entry.Name()) {
+			b, err := ioutil.ReadFile(filepath.Join(util.GetBucketDir(), entry.Name()))
+			if err != nil {
+				panic(err.Error())
+			}
+			res[entry.Name()] = b
+		}
+	}
+	return res, files
+}
+
+func TestWorkersFillTheSameBucketsE2E(t *testing.T) {
+	os.Setenv("MEDIA_PATH", "./test_midis_dupes")
+	t.Cleanup(func() {
+		os.RemoveAll("./out_workers_1")
+		os.RemoveAll("./out_workers_4")
+		os.Setenv("INDEX_PATH", "./out")
+		os.Setenv("MEDIA_PATH", "./test_midis")
+	})
+	assert := assert.New(t)
+
+	os.Setenv("INDEX_PATH", "./out_workers_1")
+	expected, expectedFiles := fillBuckets(1)
+	assert.NotEmpty(expected)
+
+	os.Setenv("INDEX_PATH", "./out_workers_4")
+	buckets, files := fillBuckets(4)
+	assert.Equal(expected, buckets)
+	assert.Equal(expectedFiles, files)
+}
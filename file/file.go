@@ -1,7 +1,12 @@
 package file
 
 import (
+	"os"
+	"path/filepath"
+	"sort"
+
 	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
 )
 
 func CreateFileNumMap(paths []string) model.FileNumToMidiPath {
@@ -12,3 +17,59 @@ func CreateFileNumMap(paths []string) model.FileNumToMidiPath {
 	}
 	return res
 }
+
+// ExtendFileNumMap gives the paths that aren't in m yet the file numbers after
+// maxNum, the highest one the index ever had, and returns just the new ones
+func ExtendFileNumMap(m model.FileNumToMidiPath, paths []string, maxNum uint32) model.FileNumToMidiPath {
+	known := make(map[string]bool)
+	for _, path := range m {
+		known[path] = true
+	}
+
+	res := make(model.FileNumToMidiPath)
+	for _, path := range paths {
+		if !known[path] {
+			maxNum += 1
+			m[maxNum] = path
+			res[maxNum] = path
+			known[path] = true
+		}
+	}
+	return res
+}
+
+// FindFileNums returns the numbers of the files in m stored under path,
+// which is either relative to the media dir like the stored paths or absolute
+func FindFileNums(m model.FileNumToMidiPath, path string) []uint32 {
+	relPath := filepath.Clean(path)
+	if filepath.IsAbs(path) {
+		mediaDir, err := filepath.Abs(util.GetMediaDir())
+		if err != nil {
+			panic("Could not find media dir: " + err.Error())
+		}
+		relPath, err = filepath.Rel(mediaDir, path)
+		if err != nil {
+			return nil
+		}
+	}
+
+	var res []uint32
+	for num, p := range m {
+		if p == relPath {
+			res = append(res, num)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+	return res
+}
+
+// ReadDeletedFiles reads the files that were removed from the index but
+// are still in its chunks
+func ReadDeletedFiles() model.FileNumSet {
+	if _, err := os.Stat(util.GetDeletedFilesPath()); os.IsNotExist(err) {
+		return make(model.FileNumSet)
+	}
+	return util.ReadBinaryOrPanic[model.FileNumSet](util.GetDeletedFilesPath())
+}
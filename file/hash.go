@@ -0,0 +1,43 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/jsphweid/harmondex/chord"
+	"github.com/jsphweid/harmondex/model"
+)
+
+const contentHashPrefix = "content:"
+const notesHashPrefix = "notes:"
+
+// HashContent hashes the bytes of a midi file so byte-identical copies have
+// the same hash
+func HashContent(b []byte) string {
+	sum := sha256.Sum256(b)
+	return contentHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// HashNotes hashes just the notes and timing of the chords of a midi file so
+// copies that only differ in things like track names have the same hash
+func HashNotes(chords []model.Chord) string {
+	h := sha256.New()
+	buf := make([]byte, 4)
+	for _, c := range chords {
+		binary.LittleEndian.PutUint32(buf, c.AbsTickOffset)
+		h.Write(buf)
+		h.Write([]byte(chord.CreateChordKey(c.Notes) + ";"))
+	}
+	return notesHashPrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+func NewIndexedFiles() model.IndexedFiles {
+	var res model.IndexedFiles
+	res.Keys = make(model.FileNumToKey)
+	res.Hashes = make(model.FileHashToFileNum)
+	res.AlternatePaths = make(model.FileNumToAlternatePaths)
+	res.Removed.Paths = make(map[string]bool)
+	res.Removed.Hashes = make(map[string]bool)
+	return res
+}
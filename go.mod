@@ -3,13 +3,13 @@ module github.com/jsphweid/harmondex
 go 1.18
 
 require (
+	github.com/aws/aws-sdk-go v1.44.56
 	github.com/google/uuid v1.3.0
 	github.com/spf13/cobra v1.5.0
 	gitlab.com/gomidi/midi/v2 v2.0.22
 )
 
 require (
-	github.com/aws/aws-sdk-go v1.44.56 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
@@ -0,0 +1,63 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+)
+
+// Create makes a manifest for an index being built now with this build's
+// parameters
+func Create(numFiles int, maxFileNum uint32) model.Manifest {
+	var m model.Manifest
+	m.FormatVersion = constants.IndexFormatVersion
+	m.BuiltAt = time.Now().UTC()
+	m.NewChordThreshold = constants.NewChordThreshold
+	m.PreferredChunkSize = constants.PreferredChunkSize
+	m.MinChordSize = constants.MinChordSize
+	m.MaxChordSize = constants.MaxChordSize
+	m.NumFiles = numFiles
+	m.MaxFileNum = maxFileNum
+	return m
+}
+
+func Write(m model.Manifest) {
+	util.CreateBinary(util.GetManifestPath(), m)
+}
+
+// Read reads the manifest of the index, failing if the index was built by
+// something that isn't understood
+func Read() (model.Manifest, error) {
+	var m model.Manifest
+	if _, err := os.Stat(util.GetManifestPath()); os.IsNotExist(err) {
+		return m, errors.New("index has no manifest, it has to be rebuilt")
+	}
+
+	m = util.ReadBinaryOrPanic[model.Manifest](util.GetManifestPath())
+	if m.FormatVersion != constants.IndexFormatVersion {
+		return m, fmt.Errorf("index format version is %v but only %v is supported, it has to be rebuilt", m.FormatVersion, constants.IndexFormatVersion)
+	}
+	return m, nil
+}
+
+func ReadOrPanic() model.Manifest {
+	m, err := Read()
+	if err != nil {
+		panic("Could not use index: " + err.Error())
+	}
+	return m
+}
+
+// HasSameBuildParameters is whether chords from this build can be added to
+// the index without it becoming inconsistent
+func HasSameBuildParameters(m model.Manifest) bool {
+	current := Create(m.NumFiles, m.MaxFileNum)
+	current.BuiltAt = m.BuiltAt
+	current.Generation = m.Generation
+	return m == current
+}
@@ -9,9 +9,21 @@ import (
 	"gitlab.com/gomidi/midi/v2/smf"
 )
 
-func ReadMidiFile(filepath string) (s *smf.SMF, e error) {
+func ReadMidiFile(filepath string) (*smf.SMF, error) {
+	var blank smf.SMF
+
+	dat, err := os.ReadFile(filepath)
+
+	if err != nil {
+		errText := fmt.Sprintf("Error reading midi file... %s", err.Error())
+		return &blank, errors.New(errText)
+	}
+
+	return ReadMidi(dat)
+}
+
+func ReadMidi(dat []byte) (s *smf.SMF, e error) {
 	var blank smf.SMF
-	var err error
 
 	// handle panics
 	// https://github.com/gomidi/midi/issues/20
@@ -21,12 +33,6 @@ func ReadMidiFile(filepath string) (s *smf.SMF, e error) {
 		}
 	}()
 
-	dat, err := os.ReadFile(filepath)
-
-	if err != nil {
-		errText := fmt.Sprintf("Error reading midi file... %s", err.Error())
-		return &blank, errors.New(errText)
-	}
 	res, err := smf.ReadFrom(bytes.NewReader(dat))
 
 	if err != nil {
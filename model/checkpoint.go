@@ -0,0 +1,21 @@
+package model
+
+// BucketCheckpoint is how far filling buckets got
+type BucketCheckpoint struct {
+	// files are put in buckets in file number order
+	NumFilesDone int
+
+	// size of every bucket file once NumFilesDone files were in them
+	BucketSizes map[string]int64
+
+	Files IndexedFiles
+}
+
+// ChunkCheckpoint is how far making chunks out of buckets got
+type ChunkCheckpoint struct {
+	// buckets are made into chunks in filename order
+	NumBucketsDone int
+
+	// every chunk made out of the first NumBucketsDone buckets
+	Chunks []ChunkOverview
+}
@@ -6,6 +6,7 @@ type Chord struct {
 	AbsTickOffset         uint32
 	Notes                 Notes
 	FileNum               uint32
+	SeqNum                uint32 // position in the file's chord sequence
 	FileHasMetadata       bool
 	FormedByNoteOn        bool
 	OldestEventWithin1Sec bool
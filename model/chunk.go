@@ -4,8 +4,35 @@ type ChunkOverview struct {
 	Start    string
 	End      string
 	Filename string
+
+	// crc32 of the whole chunk file
+	Checksum uint32
+}
+
+// PostingBlock is part of the postings of a key that starts with a file
+type PostingBlock struct {
+	Start     uint32 // offset in the data section
+	FirstFile uint32 // number of files of the key in blocks before this one
+
+	// num of the last file before the block, file nums are stored as the
+	// difference from the one before
+	PrevFile uint32
+}
+
+// IndexEntry is where the postings of a key are in the data section of a
+// chunk. Postings are grouped by file, best ranked files first.
+type IndexEntry struct {
+	Pair
+	NumFiles    uint32
+	NumPostings uint32
+
+	// only set when there are more than constants.PostingBlockSize bytes of
+	// postings so pages of files can be read without reading all of them
+	Blocks []PostingBlock
 }
 
-type ChunkIndex = map[string]Pair
+// ChunkIndex is the index of a chunk that's being written, chunk files have
+// it laid out as a sorted key table
+type ChunkIndex = map[string]IndexEntry
 type ChunkNum = uint32
 type ChunkNumToFilename = map[ChunkNum]string
@@ -0,0 +1,24 @@
+package model
+
+// KeyLocation is where a key's entry is in the chunks of the index
+type KeyLocation struct {
+	Chunk uint32 // position in allChunks.dat
+	Entry uint32 // position in the chunk's key table
+}
+
+// SampledKey is one of the keys of the key dictionary that's kept in memory
+// to find where to start reading the rest
+type SampledKey struct {
+	Key    string
+	Offset int64
+}
+
+// KeySample is what's saved to the key sample
+type KeySample struct {
+	Keys []SampledKey
+
+	// what the key dictionary was made from, since KeyLocations are only
+	// right for those chunks in that order
+	Chunks         []string
+	DictionarySize int64
+}
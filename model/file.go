@@ -1,3 +1,28 @@
 package model
 
 type FileNumToMidiPath = map[uint32]string
+
+// set of file nums, e.g. files removed from the index
+type FileNumSet = map[uint32]bool
+
+// content hash of a midi file to the num of the file it was indexed as
+type FileHashToFileNum = map[string]uint32
+
+// file num to the paths of other files with the same content that were
+// skipped instead of being indexed again
+type FileNumToAlternatePaths = map[uint32][]string
+
+// RemovedFiles are the paths and content hashes of files that were removed
+// from the index, which are never indexed again
+type RemovedFiles struct {
+	Paths  map[string]bool
+	Hashes map[string]bool
+}
+
+// IndexedFiles is what's learned about midi files while putting them in buckets
+type IndexedFiles struct {
+	Keys           FileNumToKey
+	Hashes         FileHashToFileNum
+	AlternatePaths FileNumToAlternatePaths
+	Removed        RemovedFiles
+}
@@ -1,16 +1,40 @@
 package model
 
+// HitExplanation is why a hit was ranked where it was
+type HitExplanation struct {
+	RankScore             uint8 `json:"rank_score"`
+	FileHasMetadata       bool  `json:"file_has_metadata"`
+	FormedByNoteOn        bool  `json:"formed_by_note_on"`
+	OldestEventWithin1Sec bool  `json:"oldest_event_within_1_sec"`
+}
+
 type SearchResultV2 struct {
-	FileId         uint32        `json:"file_id"`
-	AbsTickOffsets []uint32      `json:"abs_tick_offsets"`
-	MidiMetadata   *MidiMetadata `json:"midi_metadata"`
+	FileId         uint32           `json:"file_id"`
+	AbsTickOffsets []uint32         `json:"abs_tick_offsets"`
+	Transpositions []int8           `json:"transpositions,omitempty"`
+	Distances      []int            `json:"distances,omitempty"`
+	Key            string           `json:"key,omitempty"`             // estimated key, only set for numeral searches
+	Explanations   []HitExplanation `json:"explanations,omitempty"`    // only set with explain=true
+	AlternatePaths []string         `json:"alternate_paths,omitempty"` // other files with the same content
+	MidiMetadata   *MidiMetadata    `json:"midi_metadata"`
 }
 
 type SearchResponse struct {
-	Start      int              `json:"start"`
-	NumMatches int              `json:"num_matches"`
-	NumFiles   int              `json:"num_files"`
-	Results    []SearchResultV2 `json:"results"`
+	// true when results are near matches, which is also the case when an
+	// exact search didn't match anything
+	Approximate bool             `json:"approximate,omitempty"`
+	Start       int              `json:"start"`
+	NumMatches  int              `json:"num_matches"`
+	NumFiles    int              `json:"num_files"`
+	Results     []SearchResultV2 `json:"results"`
+
+	// true when the query matched more than constants.MaxKeysPerQuery
+	// distinct chords and only the matches of some of them were searched, so
+	// the totals are too low
+	Truncated bool `json:"truncated,omitempty"`
+
+	// sent back as cursor to get the next page, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 type MidiMetadata struct {
@@ -20,8 +44,63 @@ type MidiMetadata struct {
 	Release string `json:"release"`
 }
 
+type SearchMode = string
+
+const (
+	ExactSearch       SearchMode = "exact"
+	TransposedSearch  SearchMode = "transposed"
+	PitchClassSearch  SearchMode = "pitch_class"
+	ContainsSearch    SearchMode = "contains" // indexed chords with at least these notes
+	WithinSearch      SearchMode = "within"   // indexed chords with only these notes
+	ApproximateSearch SearchMode = "approximate"
+
+	// not sent by users, it's what searches with Numerals are
+	NumeralSearch SearchMode = "numeral"
+)
+
+type Voicing = string
+
+const (
+	ExactVoicing Voicing = "exact"
+	AnyVoicing   Voicing = "any"
+)
+
+type KeyMode = string
+
+const (
+	MajorKey KeyMode = "major"
+	MinorKey KeyMode = "minor"
+)
+
+type MetadataFilter struct {
+	MinYear uint   `json:"min_year"` // inclusive
+	MaxYear uint   `json:"max_year"` // inclusive
+	Artist  string `json:"artist"`   // case insensitive substring
+	Title   string `json:"title"`    // case insensitive substring
+}
+
 type SearchRequestBody struct {
+	// more than 1 chord means the chords have to happen one after another
 	Chords []Notes
+	Mode   SearchMode `json:"mode"` // defaults to ExactSearch
+
+	// max edits from the query for ApproximateSearch, defaults to 1
+	MaxDistance int `json:"max_distance"`
+
+	// chord symbols like "Cmaj7/E" can be sent instead of Chords
+	Symbols []string `json:"symbols"`
+	Voicing Voicing  `json:"voicing"` // defaults to ExactVoicing
+
+	// roman numerals like "ii", "V7" can be sent instead of Chords to search
+	// for a progression in any key of KeyMode
+	Numerals []string `json:"numerals"`
+	KeyMode  KeyMode  `json:"key_mode"` // defaults to MajorKey
+
+	// files without metadata never pass a filter
+	Filter *MetadataFilter `json:"filter"`
+
+	// "year", "artist" or "title", with a leading "-" for descending
+	Sort string `json:"sort"`
 }
 
 type ErrorResponse struct {
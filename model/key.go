@@ -0,0 +1,8 @@
+package model
+
+type Key struct {
+	Tonic   uint8 // pitch class
+	IsMinor bool
+}
+
+type FileNumToKey = map[uint32]Key
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// Manifest records how an index was built
+type Manifest struct {
+	FormatVersion uint32
+	BuiltAt       time.Time
+
+	NewChordThreshold  int64
+	PreferredChunkSize int
+	MinChordSize       int
+	MaxChordSize       int
+
+	NumFiles int
+
+	// highest file num the index ever had, nums of removed files aren't
+	// given to new files so links to them don't lead to other files
+	MaxFileNum uint32
+
+	// bumped whenever files are removed or the index is compacted, so
+	// cursors into the index from before aren't used
+	Generation uint32
+}
@@ -3,4 +3,14 @@ package model
 type RawResult struct {
 	AbsTickOffset uint32 // millis
 	FileId        uint32
+	SeqNum        uint32
+	LowNote       uint8
+	ChordFlag
+	RankScore uint8
+
+	// semitones between the query and the match, only set for transposed searches
+	Transposition int8
+
+	// edits between the query and the match, only set for approximate searches
+	Distance uint8
 }
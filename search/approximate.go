@@ -0,0 +1,63 @@
+package search
+
+import (
+	"sort"
+
+	"github.com/jsphweid/harmondex/chord"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/model"
+)
+
+type nearKey struct {
+	locations []model.KeyLocation
+	distance  int
+}
+
+// findNearChords finds chords within maxDistance edits of notes, closest first.
+// Only the closest constants.MaxKeysPerQuery keys are searched, it returns
+// true when there were more.
+func (idx *Index) findNearChords(notes model.Notes, maxDistance int) ([]model.RawResult, bool) {
+	var res []model.RawResult
+
+	sort.Slice(notes, func(i, j int) bool {
+		return notes[i] < notes[j]
+	})
+
+	var nearKeys []nearKey
+	idx.forEachChordKey(nil, func(indexed model.Notes, locations []model.KeyLocation) bool {
+		// every added or removed note is at least 1 edit
+		sizeDiff := len(indexed) - len(notes)
+		if sizeDiff > maxDistance || -sizeDiff > maxDistance {
+			return true
+		}
+		distance := chord.Distance(notes, indexed)
+		if distance <= maxDistance {
+			nearKeys = append(nearKeys, nearKey{locations, distance})
+		}
+		return true
+	})
+
+	sort.SliceStable(nearKeys, func(i, j int) bool {
+		return nearKeys[i].distance < nearKeys[j].distance
+	})
+	truncated := len(nearKeys) > constants.MaxKeysPerQuery
+	if truncated {
+		nearKeys = nearKeys[:constants.MaxKeysPerQuery]
+	}
+
+	for _, nk := range nearKeys {
+		matches := idx.findChordsAt(nk.locations)
+		for i := range matches {
+			matches[i].Distance = uint8(nk.distance)
+		}
+		res = append(res, matches...)
+	}
+
+	return res, truncated
+}
+
+func sortByDistance(results []model.RawResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Distance < results[j].Distance
+	})
+}
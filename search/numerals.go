@@ -0,0 +1,39 @@
+package search
+
+import (
+	"github.com/jsphweid/harmondex/chord"
+	"github.com/jsphweid/harmondex/model"
+)
+
+// FindNumeralProgression finds progressions of roman numerals in any key,
+// only keeping matches in files whose estimated key is that key
+func (idx *Index) FindNumeralProgression(numerals []string, isMinorKey bool) ([]model.RawResult, error) {
+	var res []model.RawResult
+
+	var symbols []chord.Symbol
+	for _, text := range numerals {
+		symbol, err := chord.ParseNumeral(text, isMinorKey)
+		if err != nil {
+			return res, err
+		}
+		symbols = append(symbols, symbol)
+	}
+
+	for tonic := uint8(0); tonic < 12; tonic++ {
+		var chords []model.Notes
+		for _, symbol := range symbols {
+			chords = append(chords, symbol.Transpose(tonic).PitchClasses())
+		}
+
+		key := model.Key{Tonic: tonic, IsMinor: isMinorKey}
+		// NOTE: pitch class searches only go through one key per chord
+		matches, _ := idx.FindProgression(chords, Options{Mode: model.PitchClassSearch})
+		for _, match := range matches {
+			if fileKey, ok := idx.FileKeys[match.FileId]; ok && fileKey == key {
+				res = append(res, match)
+			}
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,290 @@
+package search
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+
+	"github.com/jsphweid/harmondex/chunk"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+)
+
+// Page is the matches of some of the files that matched a search
+type Page struct {
+	// every match in the page's files, grouped by file in the order the
+	// files first showed up in the matches
+	Matches []model.RawResult
+
+	// number of the first file of the page
+	Start int
+
+	// in every page
+	NumFiles   int
+	NumMatches int
+
+	// where the page after this one starts, nil if this is the last one
+	Next *Cursor
+
+	// whether keys were left out of the search, see FindChords
+	Truncated bool
+}
+
+// Cursor is where a page of a search starts. The zero Cursor is the first
+// page.
+type Cursor struct {
+	// number of the first file of the page
+	Start int
+
+	// for searches by key, the location of the key the page starts in and
+	// the number of its files before the page, along with the totals of the
+	// search so the locations before it don't have to be read again
+	Location      int
+	LocationStart int
+	NumFiles      int
+	NumMatches    int
+}
+
+// Paginate makes a page of the matches of numFiles files starting at start,
+// with files in the order they first show up in
+func Paginate(matches []model.RawResult, start int, numFiles int) Page {
+	var res Page
+	res.Start = start
+	res.NumMatches = len(matches)
+
+	var fileIds []uint32
+	fileIdToMatches := make(map[uint32][]model.RawResult)
+	for _, match := range matches {
+		if _, ok := fileIdToMatches[match.FileId]; !ok {
+			fileIds = append(fileIds, match.FileId)
+		}
+		fileIdToMatches[match.FileId] = append(fileIdToMatches[match.FileId], match)
+	}
+
+	res.NumFiles = len(fileIds)
+	if start < 0 || start >= len(fileIds) {
+		return res
+	}
+	if start+numFiles < len(fileIds) {
+		res.Next = &Cursor{Start: start + numFiles}
+	}
+	for _, fileId := range fileIds[start:util.Min(len(fileIds), start+numFiles)] {
+		res.Matches = append(res.Matches, fileIdToMatches[fileId]...)
+	}
+	return res
+}
+
+// removedFiles are the removed files in the postings of a key in a chunk
+type removedFiles struct {
+	// sorted numbers of the files in the postings
+	positions   []int
+	numPostings int
+}
+
+// toPosition turns the number of a file that wasn't removed into its number
+// in the postings
+func (rf removedFiles) toPosition(fileNum int) int {
+	for _, position := range rf.positions {
+		if position > fileNum {
+			break
+		}
+		fileNum += 1
+	}
+	return fileNum
+}
+
+// estimated memory a removedFiles takes up besides its positions
+const removedFilesOverhead = 64
+
+func (rf removedFiles) size() int {
+	return removedFilesOverhead + 8*len(rf.positions)
+}
+
+type cachedRemovedFiles struct {
+	location model.KeyLocation
+	removedFiles
+}
+
+// removedCache keeps where the removed files are in the postings of the keys
+// that were searched most recently, at most maxBytes of them
+type removedCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	bytes    int
+	entries  map[model.KeyLocation]*list.Element
+	lru      *list.List // most recently used first
+}
+
+func newRemovedCache(maxBytes int) *removedCache {
+	return &removedCache{
+		maxBytes: maxBytes,
+		entries:  make(map[model.KeyLocation]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (c *removedCache) get(location model.KeyLocation) (removedFiles, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[location]
+	if !ok {
+		return removedFiles{}, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(cachedRemovedFiles).removedFiles, true
+}
+
+// put adds the removed files of location, forgetting the least recently used
+// ones to make room
+func (c *removedCache) put(location model.KeyLocation, rf removedFiles) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[location]; ok || rf.size() > c.maxBytes {
+		return
+	}
+	c.entries[location] = c.lru.PushFront(cachedRemovedFiles{location, rf})
+	c.bytes += rf.size()
+	for c.bytes > c.maxBytes {
+		oldest := c.lru.Remove(c.lru.Back()).(cachedRemovedFiles)
+		delete(c.entries, oldest.location)
+		c.bytes -= oldest.size()
+	}
+}
+
+// findRemovedFiles finds where the removed files are in the postings of the
+// entry. All of the postings are read unless the key was searched recently.
+func (idx *Index) findRemovedFiles(location model.KeyLocation, ce chunkEntry) removedFiles {
+	var res removedFiles
+	if len(idx.DeletedFiles) == 0 {
+		return res
+	}
+	res, ok := idx.removed.get(location)
+	if ok {
+		return res
+	}
+
+	position := 0
+	err := chunk.ForEachFileSize(ce.read(ce.Start, ce.End), 0, func(fileNum uint32, numPostings int) {
+		if idx.DeletedFiles[fileNum] {
+			res.positions = append(res.positions, position)
+			res.numPostings += numPostings
+		}
+		position += 1
+	})
+	if err != nil {
+		panic("Could not decode postings: " + err.Error())
+	}
+
+	idx.removed.put(location, res)
+	return res
+}
+
+// readFilesInChunk reads the postings of the key's files from start to end
+// in the chunk, only reading the blocks they're in. Removed files aren't
+// counted, and the number of files and postings of the key without them are
+// returned too.
+func (idx *Index) readFilesInChunk(location model.KeyLocation, start int, end int) ([]model.RawResult, int, int) {
+	var res []model.RawResult
+	ce := idx.openChunkEntry(location)
+	defer ce.close()
+
+	removed := idx.findRemovedFiles(location, ce)
+	numFiles := int(ce.NumFiles) - len(removed.positions)
+	numPostings := int(ce.NumPostings) - removed.numPostings
+	start = util.Max(start, 0)
+	end = util.Min(end, numFiles)
+	if start >= end {
+		return res, numFiles, numPostings
+	}
+	start, end = removed.toPosition(start), removed.toPosition(end)
+
+	// the last block starting at or before the first file through the
+	// block before the first one starting at or after the end
+	readStart, readEnd, firstFile, prevFile := ce.Start, ce.End, 0, uint32(0)
+	if len(ce.Blocks) > 0 {
+		i := sort.Search(len(ce.Blocks), func(i int) bool {
+			return int(ce.Blocks[i].FirstFile) > start
+		}) - 1
+		readStart = ce.Blocks[i].Start
+		firstFile = int(ce.Blocks[i].FirstFile)
+		prevFile = ce.Blocks[i].PrevFile
+		j := sort.Search(len(ce.Blocks), func(j int) bool {
+			return int(ce.Blocks[j].FirstFile) >= end
+		})
+		if j < len(ce.Blocks) {
+			readEnd = ce.Blocks[j].Start
+		}
+	}
+
+	// NOTE: postings are grouped by file
+	fileNum := firstFile - 1
+	var lastFileId uint32
+	for i, match := range ce.readPostings(readStart, readEnd, prevFile) {
+		if i == 0 || match.FileId != lastFileId {
+			fileNum += 1
+			lastFileId = match.FileId
+		}
+		if fileNum >= start && fileNum < end && !idx.DeletedFiles[match.FileId] {
+			res = append(res, match)
+		}
+	}
+	return res, numFiles, numPostings
+}
+
+// FindChordsPage is FindChords followed by Paginate, except for searches by
+// key only the blocks of postings with the page's files are read
+func (idx *Index) FindChordsPage(notes model.Notes, opts Options, cursor Cursor, numFiles int) Page {
+	keyFunc, ok := modeToKeyFunc[opts.Mode]
+	if !ok || len(notes) == 0 {
+		matches, truncated := idx.FindChords(notes, opts)
+		res := Paginate(matches, cursor.Start, numFiles)
+		res.Truncated = truncated
+		return res
+	}
+
+	var res Page
+	res.Start = cursor.Start
+	end := cursor.Start + numFiles
+	locations, _ := idx.Keys.Find(keyFunc(notes))
+
+	// NOTE: a cursor from the page before already knows the totals and
+	// which location the page starts in
+	first, filesBefore := 0, 0
+	isContinued := cursor.NumFiles > 0 && cursor.Location < len(locations)
+	if isContinued {
+		first, filesBefore = cursor.Location, cursor.Start-cursor.LocationStart
+		res.NumFiles, res.NumMatches = cursor.NumFiles, cursor.NumMatches
+	}
+
+	// NOTE: a file's postings are all in the same chunk, and files are in
+	// chunk order like findChordsByKey returns them
+	for i := first; i < len(locations); i++ {
+		if isContinued && filesBefore >= end {
+			// NOTE: the totals are already known so the rest are skipped
+			if res.Next == nil && end < res.NumFiles {
+				res.Next = &Cursor{Start: end, Location: i, LocationStart: end - filesBefore}
+			}
+			break
+		}
+		matches, numFilesInChunk, numMatchesInChunk := idx.readFilesInChunk(locations[i], cursor.Start-filesBefore, end-filesBefore)
+		res.Matches = append(res.Matches, matches...)
+		if !isContinued {
+			res.NumFiles += numFilesInChunk
+			res.NumMatches += numMatchesInChunk
+		}
+		if res.Next == nil && end >= filesBefore && end < filesBefore+numFilesInChunk {
+			res.Next = &Cursor{Start: end, Location: i, LocationStart: end - filesBefore}
+		}
+		filesBefore += numFilesInChunk
+	}
+	if res.Next != nil {
+		res.Next.NumFiles, res.Next.NumMatches = res.NumFiles, res.NumMatches
+	}
+
+	if opts.Mode == model.TransposedSearch {
+		for i := range res.Matches {
+			res.Matches[i].Transposition = int8(int(res.Matches[i].LowNote) - int(notes[0]))
+		}
+	}
+	return res
+}
@@ -0,0 +1,176 @@
+package search
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/jsphweid/harmondex/chunk"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/dictionary"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestChunk writes a chunk with a single key that has postingsPerFile
+// postings for each file id, in order
+func writeTestChunk(key string, fileIds []uint32, postingsPerFile int) model.ChunkOverview {
+	var postings []byte
+	for _, fileId := range fileIds {
+		for i := 0; i < postingsPerFile; i++ {
+			posting := make([]byte, constants.PostingSize)
+			binary.LittleEndian.PutUint32(posting[0:4], uint32(i*7))
+			binary.LittleEndian.PutUint32(posting[4:8], fileId)
+			binary.LittleEndian.PutUint32(posting[8:12], uint32(i))
+			posting[12] = 60
+			postings = append(postings, posting...)
+		}
+	}
+	return chunk.Write([]string{key}, map[string][]byte{key: postings})
+}
+
+func newTestIndex(chunks []model.ChunkOverview, maxOpenChunks int) *Index {
+	dictionary.Write(chunks)
+	return &Index{
+		Chunks:  chunks,
+		Keys:    dictionary.Open(chunks),
+		pool:    newChunkPool(maxOpenChunks, 1024*1024),
+		removed: newRemovedCache(1024 * 1024),
+	}
+}
+
+func TestFindChordsPageReadsTheSameAsPaginate(t *testing.T) {
+	os.Setenv("INDEX_PATH", t.TempDir())
+
+	var first []uint32
+	for i := uint32(1); i <= 25; i++ {
+		first = append(first, i)
+	}
+	idx := newTestIndex([]model.ChunkOverview{
+		// big enough to be split into blocks of a few files
+		writeTestChunk("60-64-67", first, 3000),
+		// like a delta chunk from incremental indexing
+		writeTestChunk("60-64-67", []uint32{26, 27, 28}, 2),
+	}, 1)
+	defer idx.Close()
+
+	assert := assert.New(t)
+	ce := idx.openChunkEntry(model.KeyLocation{Chunk: 0, Entry: 0})
+	assert.Greater(len(ce.Blocks), 3)
+	ce.close()
+
+	notes := model.Notes{60, 64, 67}
+	for _, start := range []int{0, 3, 4, 10, 22, 25, 27, 28, 40} {
+		matches, _ := idx.FindChords(notes, Options{})
+		expected := Paginate(matches, start, 10)
+		page := idx.FindChordsPage(notes, Options{}, Cursor{Start: start}, 10)
+		assert.Equal(expected.Matches, page.Matches, "start %v", start)
+		assert.Equal(expected.NumFiles, page.NumFiles, "start %v", start)
+		assert.Equal(expected.NumMatches, page.NumMatches, "start %v", start)
+		assert.Equal(expected.Next == nil, page.Next == nil, "start %v", start)
+	}
+
+	page := idx.FindChordsPage(notes, Options{}, Cursor{Start: 20}, 10)
+	assert.Equal(28, page.NumFiles)
+	assert.Equal(25*3000+3*2, page.NumMatches)
+	assert.Len(page.Matches, 5*3000+3*2)
+	assert.Equal(uint32(21), page.Matches[0].FileId)
+}
+
+// assertCursorsPageLikePaginate follows the cursors of pages of numFiles
+// files through every match of notes
+func assertCursorsPageLikePaginate(t *testing.T, idx *Index, notes model.Notes, numFiles int) {
+	assert := assert.New(t)
+	matches, _ := idx.FindChords(notes, Options{})
+	all := Paginate(matches, 0, len(matches))
+
+	var cursor Cursor
+	numPages := 0
+	for {
+		expected := Paginate(matches, cursor.Start, numFiles)
+		page := idx.FindChordsPage(notes, Options{}, cursor, numFiles)
+		assert.Equal(expected.Matches, page.Matches, "%v files from %v", numFiles, cursor.Start)
+		assert.Equal(all.NumFiles, page.NumFiles)
+		assert.Equal(all.NumMatches, page.NumMatches)
+		numPages += 1
+		if page.Next == nil {
+			break
+		}
+		assert.Equal(cursor.Start+numFiles, page.Next.Start)
+		cursor = *page.Next
+	}
+	assert.Equal((all.NumFiles+numFiles-1)/numFiles, numPages, "%v files", numFiles)
+}
+
+func TestFindChordsPageFollowsCursors(t *testing.T) {
+	os.Setenv("INDEX_PATH", t.TempDir())
+
+	var first []uint32
+	for i := uint32(1); i <= 25; i++ {
+		first = append(first, i)
+	}
+	idx := newTestIndex([]model.ChunkOverview{
+		writeTestChunk("60-64-67", first, 3000),
+		writeTestChunk("60-64-67", []uint32{26, 27, 28}, 2),
+	}, 1)
+	defer idx.Close()
+
+	for _, numFiles := range []int{1, 4, 5, 25, 30} {
+		assertCursorsPageLikePaginate(t, idx, model.Notes{60, 64, 67}, numFiles)
+	}
+}
+
+func TestFindChordsPageSkipsRemovedFiles(t *testing.T) {
+	os.Setenv("INDEX_PATH", t.TempDir())
+
+	var first []uint32
+	for i := uint32(1); i <= 25; i++ {
+		first = append(first, i)
+	}
+	idx := newTestIndex([]model.ChunkOverview{
+		writeTestChunk("60-64-67", first, 3000),
+		writeTestChunk("60-64-67", []uint32{26, 27, 28}, 2),
+		writeTestChunk("60-64-67", []uint32{29}, 2),
+	}, 1)
+	defer idx.Close()
+	idx.DeletedFiles = model.FileNumSet{1: true, 2: true, 13: true, 25: true, 27: true, 29: true}
+
+	assert := assert.New(t)
+	page := idx.FindChordsPage(model.Notes{60, 64, 67}, Options{}, Cursor{}, 10)
+	assert.Equal(23, page.NumFiles)
+	assert.Equal(21*3000+2*2, page.NumMatches)
+	assert.Equal(uint32(3), page.Matches[0].FileId)
+
+	for _, start := range []int{0, 3, 10, 19, 22, 23} {
+		matches, _ := idx.FindChords(model.Notes{60, 64, 67}, Options{})
+		expected := Paginate(matches, start, 10)
+		page := idx.FindChordsPage(model.Notes{60, 64, 67}, Options{}, Cursor{Start: start}, 10)
+		assert.Equal(expected.Matches, page.Matches, "start %v", start)
+		assert.Equal(expected.Next == nil, page.Next == nil, "start %v", start)
+	}
+	for _, numFiles := range []int{1, 4, 11, 23} {
+		assertCursorsPageLikePaginate(t, idx, model.Notes{60, 64, 67}, numFiles)
+	}
+}
+
+func TestRemovedCacheForgetsTheLeastRecentlyUsed(t *testing.T) {
+	assert := assert.New(t)
+	rf := removedFiles{positions: []int{1, 2}, numPostings: 3}
+	c := newRemovedCache(3 * rf.size())
+
+	for i := uint32(0); i < 3; i++ {
+		c.put(model.KeyLocation{Chunk: i}, rf)
+	}
+	_, ok := c.get(model.KeyLocation{Chunk: 0})
+	assert.True(ok)
+	c.put(model.KeyLocation{Chunk: 3}, rf)
+
+	_, ok = c.get(model.KeyLocation{Chunk: 1})
+	assert.False(ok)
+	for _, i := range []uint32{0, 2, 3} {
+		cached, ok := c.get(model.KeyLocation{Chunk: i})
+		assert.True(ok)
+		assert.Equal(rf, cached)
+	}
+	assert.Equal(3*rf.size(), c.bytes)
+}
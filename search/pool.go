@@ -0,0 +1,174 @@
+package search
+
+import (
+	"container/list"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/jsphweid/harmondex/chunk"
+	"github.com/jsphweid/harmondex/util"
+)
+
+// openChunk is a chunk file kept open with its key table read. The file is
+// only read with ReadAt so it can be read by any number of searches at once.
+type openChunk struct {
+	filename  string
+	f         *os.File
+	table     chunk.KeyTable
+	dataStart int64
+
+	// searches using the chunk, it's only closed once there are none
+	refs    int
+	evicted bool
+	elem    *list.Element
+}
+
+// chunkPool keeps chunks open between searches. At most maxOpen chunks are
+// open and their key tables are at most maxBytes, the least recently used
+// chunks are closed to make room. Postings aren't kept, searches read the
+// ones they need themselves.
+type chunkPool struct {
+	mu       sync.Mutex
+	maxOpen  int
+	maxBytes int
+	bytes    int
+	chunks   map[string]*openChunk
+	lru      *list.List // most recently used first
+	closed   bool
+
+	// chunks a search is opening, the channel is closed once it's done
+	opening map[string]chan struct{}
+}
+
+func newChunkPool(maxOpen int, maxBytes int) *chunkPool {
+	return &chunkPool{
+		maxOpen:  util.Max(maxOpen, 1),
+		maxBytes: maxBytes,
+		chunks:   make(map[string]*openChunk),
+		lru:      list.New(),
+		opening:  make(map[string]chan struct{}),
+	}
+}
+
+func openChunkFile(filename string) *openChunk {
+	f := util.OpenFileOrPanic(filepath.Join(util.GetIndexDir(), filename))
+	t, indexLength := chunk.ReadKeyTableOrPanic(f)
+	return &openChunk{
+		filename:  filename,
+		f:         f,
+		table:     t,
+		dataStart: int64(indexLength) + 4,
+	}
+}
+
+// acquire returns the open chunk, opening it if it isn't already. It has to
+// be released when the search is done with it.
+func (p *chunkPool) acquire(filename string) *openChunk {
+	p.mu.Lock()
+	for {
+		if oc, ok := p.chunks[filename]; ok {
+			p.lru.MoveToFront(oc.elem)
+			oc.refs += 1
+			p.mu.Unlock()
+			return oc
+		}
+		opening, ok := p.opening[filename]
+		if !ok {
+			break
+		}
+		// NOTE: checked again after since it could be evicted right away
+		// or fail to open
+		p.mu.Unlock()
+		<-opening
+		p.mu.Lock()
+	}
+	opening := make(chan struct{})
+	p.opening[filename] = opening
+	p.mu.Unlock()
+
+	// NOTE: opened without holding the lock so searches of chunks that are
+	// already open don't wait on reading the key table
+	var oc *openChunk
+	defer func() {
+		if oc == nil {
+			p.mu.Lock()
+			delete(p.opening, filename)
+			close(opening)
+			p.mu.Unlock()
+		}
+	}()
+	oc = openChunkFile(filename)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.opening, filename)
+	close(opening)
+	if p.closed {
+		oc.evicted = true
+	} else {
+		oc.elem = p.lru.PushFront(oc)
+		p.chunks[filename] = oc
+		p.bytes += oc.table.Size()
+		p.evict()
+	}
+	oc.refs += 1
+	return oc
+}
+
+func (p *chunkPool) release(oc *openChunk) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	oc.refs -= 1
+	if oc.evicted && oc.refs == 0 {
+		oc.f.Close()
+	}
+}
+
+// evict takes the least recently used chunks out of the pool until it's
+// within its limits, but never the one that was just opened
+func (p *chunkPool) evict() {
+	for p.lru.Len() > 1 && (p.lru.Len() > p.maxOpen || p.bytes > p.maxBytes) {
+		p.remove(p.lru.Back().Value.(*openChunk))
+	}
+}
+
+// remove takes the chunk out of the pool, closing it once it's released if
+// it's in use
+func (p *chunkPool) remove(oc *openChunk) {
+	p.lru.Remove(oc.elem)
+	delete(p.chunks, oc.filename)
+	p.bytes -= oc.table.Size()
+	oc.evicted = true
+	if oc.refs == 0 {
+		oc.f.Close()
+	}
+}
+
+// isFull reports whether opening another chunk would close one
+func (p *chunkPool) isFull() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lru.Len() >= p.maxOpen || p.bytes >= p.maxBytes
+}
+
+// warm opens chunks in order until the pool is full
+func (p *chunkPool) warm(filenames []string) {
+	for _, filename := range filenames {
+		if p.isFull() {
+			return
+		}
+		p.release(p.acquire(filename))
+	}
+}
+
+// close closes every chunk, including ones in use once they're released
+func (p *chunkPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for p.lru.Len() > 0 {
+		p.remove(p.lru.Back().Value.(*openChunk))
+	}
+}
@@ -0,0 +1,98 @@
+package search
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/jsphweid/harmondex/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchesShareABoundedPoolOfChunks(t *testing.T) {
+	os.Setenv("INDEX_PATH", t.TempDir())
+	assert := assert.New(t)
+
+	idx := newTestIndex([]model.ChunkOverview{
+		writeTestChunk("60-64-67", []uint32{1, 2, 3}, 1),
+		writeTestChunk("60-64-67", []uint32{4, 5}, 1),
+		writeTestChunk("60-64-67", []uint32{6}, 1),
+	}, 2)
+	notes := model.Notes{60, 64, 67}
+	expected, _ := idx.FindChords(notes, Options{})
+	assert.Len(expected, 6)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			matches, _ := idx.FindChords(notes, Options{})
+			assert.Equal(expected, matches)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(2, idx.pool.lru.Len())
+	assert.Len(idx.pool.chunks, 2)
+
+	// the key tables don't all fit so only the last one used is kept
+	idx.pool.maxBytes = 1
+	idx.FindChords(notes, Options{})
+	assert.Equal(1, idx.pool.lru.Len())
+	assert.Contains(idx.pool.chunks, idx.Chunks[2].Filename)
+
+	idx.Close()
+	assert.Equal(0, idx.pool.lru.Len())
+	assert.Equal(0, idx.pool.bytes)
+}
+
+func TestChunksInUseAreClosedOnceReleased(t *testing.T) {
+	os.Setenv("INDEX_PATH", t.TempDir())
+	assert := assert.New(t)
+	chunkA := writeTestChunk("60-64-67", []uint32{1}, 1)
+	chunkB := writeTestChunk("60-64-67", []uint32{2}, 1)
+
+	pool := newChunkPool(1, 1024*1024)
+	a := pool.acquire(chunkA.Filename)
+	pool.release(pool.acquire(chunkB.Filename))
+	assert.True(a.evicted)
+
+	// still readable until it's released
+	buf := make([]byte, 1)
+	_, err := a.f.ReadAt(buf, a.dataStart)
+	assert.Nil(err)
+
+	pool.release(a)
+	_, err = a.f.ReadAt(buf, a.dataStart)
+	assert.ErrorIs(err, os.ErrClosed)
+}
+
+func TestChunksAreOnlyOpenedOnce(t *testing.T) {
+	os.Setenv("INDEX_PATH", t.TempDir())
+	assert := assert.New(t)
+	chunkA := writeTestChunk("60-64-67", []uint32{1}, 1)
+
+	pool := newChunkPool(1, 1024*1024)
+	var wg sync.WaitGroup
+	opened := make([]*openChunk, 20)
+	for i := range opened {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			opened[i] = pool.acquire(chunkA.Filename)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, oc := range opened {
+		assert.Same(opened[0], oc)
+	}
+	assert.Equal(len(opened), opened[0].refs)
+	assert.Empty(pool.opening)
+
+	// a chunk that can't be opened isn't stuck opening
+	assert.Panics(func() { pool.acquire("missing.dat") })
+	assert.Empty(pool.opening)
+	assert.Panics(func() { pool.acquire("missing.dat") })
+}
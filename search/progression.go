@@ -0,0 +1,74 @@
+package search
+
+import (
+	"github.com/jsphweid/harmondex/model"
+)
+
+type fileSeq struct {
+	fileId        uint32
+	seqNum        uint32
+	transposition int8
+}
+
+// makeFileSeqToDistance maps where each result is to its smallest distance
+func makeFileSeqToDistance(results []model.RawResult) map[fileSeq]uint8 {
+	res := make(map[fileSeq]uint8)
+	for _, r := range results {
+		key := fileSeq{r.FileId, r.SeqNum, r.Transposition}
+		if distance, ok := res[key]; !ok || r.Distance < distance {
+			res[key] = r.Distance
+		}
+	}
+	return res
+}
+
+// FindProgression returns the matches of the first chord that are directly
+// followed by the rest of the chords, in order, within the same file (and at
+// the same transposition for transposed searches). Distances of approximate
+// matches are added up over the whole progression. Like FindChords it returns
+// true when keys were left out of the search of any of the chords.
+func (idx *Index) FindProgression(chords []model.Notes, opts Options) ([]model.RawResult, bool) {
+	var res []model.RawResult
+
+	if len(chords) == 0 {
+		return res, false
+	}
+
+	first, truncated := idx.FindChords(chords[0], opts)
+	if len(chords) == 1 || len(first) == 0 {
+		return first, truncated
+	}
+
+	// NOTE: seqNums are consecutive within a file, so chord i of a
+	// progression starting at seqNum n has to be at seqNum n+i
+	var following []map[fileSeq]uint8
+	for _, notes := range chords[1:] {
+		matches, isTruncated := idx.FindChords(notes, opts)
+		if len(matches) == 0 {
+			return res, truncated
+		}
+		truncated = truncated || isTruncated
+		following = append(following, makeFileSeqToDistance(matches))
+	}
+
+	for _, match := range first {
+		isProgression := true
+		for i, m := range following {
+			distance, ok := m[fileSeq{match.FileId, match.SeqNum + uint32(i+1), match.Transposition}]
+			if !ok {
+				isProgression = false
+				break
+			}
+			match.Distance += distance
+		}
+		if isProgression {
+			res = append(res, match)
+		}
+	}
+
+	if opts.Mode == model.ApproximateSearch {
+		sortByDistance(res)
+	}
+
+	return res, truncated
+}
@@ -0,0 +1,109 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jsphweid/harmondex/chord"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/model"
+)
+
+// notesMatcher reports whether an indexed chord is related to the query,
+// both are sorted
+type notesMatcher = func(query model.Notes, indexed model.Notes) bool
+
+// isSubset reports whether every note in a is in b, both sorted
+func isSubset(a model.Notes, b model.Notes) bool {
+	j := 0
+	for _, note := range a {
+		for j < len(b) && b[j] < note {
+			j++
+		}
+		if j == len(b) || b[j] != note {
+			return false
+		}
+		j++
+	}
+	return true
+}
+
+func containsAll(query model.Notes, indexed model.Notes) bool {
+	return isSubset(query, indexed)
+}
+
+func isWithin(query model.Notes, indexed model.Notes) bool {
+	return isSubset(indexed, query)
+}
+
+// withinKeyPrefixes returns what the keys of chords within query can start
+// with, which is one of its notes
+func withinKeyPrefixes(query model.Notes) []string {
+	var res []string
+	for i, note := range query {
+		if i == 0 || note != query[i-1] {
+			res = append(res, fmt.Sprintf("%v-", note))
+		}
+	}
+	// NOTE: in key order so keys are found in the same order as they would
+	// be going through every key
+	sort.Strings(res)
+	return res
+}
+
+// forEachChordKey calls fn with every chord.CreateChordKey key that starts
+// with one of prefixes, or every one if there aren't any, in key order until
+// fn returns false
+func (idx *Index) forEachChordKey(prefixes []string, fn func(notes model.Notes, locations []model.KeyLocation) bool) {
+	stopped := false
+	visit := func(key string, locations []model.KeyLocation) bool {
+		stopped = !fn(chord.ParseChordKey(key), locations)
+		return !stopped
+	}
+	if len(prefixes) == 0 {
+		idx.Keys.ForEachInRange(chord.ChordKeysStart, chord.ChordKeysEnd, visit)
+		return
+	}
+	for _, prefix := range prefixes {
+		idx.Keys.ForEachWithPrefix(prefix, visit)
+		if stopped {
+			return
+		}
+	}
+}
+
+// findRelatedChords finds every indexed chord that the matcher accepts, or
+// those of the first constants.MaxKeysPerQuery keys it accepts, in which case
+// it returns true. getPrefixes narrows down the keys that have to be checked,
+// every chord key is checked if it's nil.
+func (idx *Index) findRelatedChords(notes model.Notes, matches notesMatcher, getPrefixes func(model.Notes) []string) ([]model.RawResult, bool) {
+	var res []model.RawResult
+	truncated := false
+
+	sort.Slice(notes, func(i, j int) bool {
+		return notes[i] < notes[j]
+	})
+
+	var prefixes []string
+	if getPrefixes != nil {
+		prefixes = getPrefixes(notes)
+	}
+
+	numKeys := 0
+	idx.forEachChordKey(prefixes, func(indexed model.Notes, locations []model.KeyLocation) bool {
+		if !matches(notes, indexed) {
+			return true
+		}
+
+		// NOTE: really vague queries can match a huge part of the index
+		if numKeys == constants.MaxKeysPerQuery {
+			truncated = true
+			return false
+		}
+		res = append(res, idx.findChordsAt(locations)...)
+		numKeys += 1
+		return true
+	})
+
+	return res, truncated
+}
@@ -0,0 +1,46 @@
+package search
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/jsphweid/harmondex/chunk"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTooManyRelatedKeysAreTruncated(t *testing.T) {
+	os.Setenv("INDEX_PATH", t.TempDir())
+
+	// one more chord with 60 than a query can search
+	var keys []string
+	keyToPostings := make(map[string][]byte)
+	for a := 61; a < 128 && len(keys) <= constants.MaxKeysPerQuery; a++ {
+		for b := a + 1; b < 128 && len(keys) <= constants.MaxKeysPerQuery; b++ {
+			key := fmt.Sprintf("60-%v-%v", a, b)
+			posting := make([]byte, constants.PostingSize)
+			binary.LittleEndian.PutUint32(posting[4:8], uint32(len(keys)+1))
+			keys = append(keys, key)
+			keyToPostings[key] = posting
+		}
+	}
+	sort.Strings(keys)
+	idx := newTestIndex([]model.ChunkOverview{chunk.Write(keys, keyToPostings)}, 1)
+	defer idx.Close()
+
+	assert := assert.New(t)
+	matches, truncated := idx.FindChords(model.Notes{60}, Options{Mode: model.ContainsSearch})
+	assert.True(truncated)
+	assert.Len(matches, constants.MaxKeysPerQuery)
+
+	matches, truncated = idx.FindChords(model.Notes{60, 61}, Options{Mode: model.ContainsSearch})
+	assert.False(truncated)
+	assert.Len(matches, 66)
+
+	_, truncated = idx.FindChords(model.Notes{60, 61, 62}, Options{Mode: model.ApproximateSearch, MaxDistance: 4})
+	assert.True(truncated)
+}
@@ -0,0 +1,202 @@
+package search
+
+import (
+	"encoding/binary"
+
+	"github.com/jsphweid/harmondex/chord"
+	"github.com/jsphweid/harmondex/chunk"
+	"github.com/jsphweid/harmondex/constants"
+	"github.com/jsphweid/harmondex/dictionary"
+	"github.com/jsphweid/harmondex/file"
+	"github.com/jsphweid/harmondex/model"
+	"github.com/jsphweid/harmondex/util"
+)
+
+type Index struct {
+	Chunks []model.ChunkOverview
+
+	// every key in the index and the chunks it's in
+	Keys *dictionary.Dictionary
+
+	// estimated key of each file
+	FileKeys model.FileNumToKey
+
+	// files removed from the index that are still in chunks
+	DeletedFiles model.FileNumSet
+
+	pool *chunkPool
+
+	// where DeletedFiles are in the postings of keys that were paged through
+	removed *removedCache
+}
+
+type Options struct {
+	Mode model.SearchMode
+
+	// only used by model.ApproximateSearch
+	MaxDistance int
+}
+
+var modeToKeyFunc = map[model.SearchMode]chord.KeyFunc{
+	"":                     chord.CreateChordKey,
+	model.ExactSearch:      chord.CreateChordKey,
+	model.TransposedSearch: chord.CreateTransposedChordKey,
+	model.PitchClassSearch: chord.CreatePitchClassKey,
+}
+
+var modeToNotesMatcher = map[model.SearchMode]notesMatcher{
+	model.ContainsSearch: containsAll,
+	model.WithinSearch:   isWithin,
+}
+
+var modeToKeyPrefixes = map[model.SearchMode]func(model.Notes) []string{
+	model.WithinSearch: withinKeyPrefixes,
+}
+
+func LoadIndex() *Index {
+	var idx Index
+	idx.Chunks = util.ReadBinaryOrPanic[[]model.ChunkOverview](util.GetAllChunksPath())
+	idx.Keys = dictionary.Open(idx.Chunks)
+	idx.FileKeys = util.ReadBinaryOrPanic[model.FileNumToKey](util.GetFileKeysPath())
+	idx.DeletedFiles = file.ReadDeletedFiles()
+	idx.pool = newChunkPool(constants.MaxOpenChunks, constants.MaxOpenChunkIndexMB*1024*1024)
+	idx.removed = newRemovedCache(constants.MaxRemovedFilesCacheMB * 1024 * 1024)
+	var filenames []string
+	for _, c := range idx.Chunks {
+		filenames = append(filenames, c.Filename)
+	}
+	idx.pool.warm(filenames)
+	return &idx
+}
+
+// Close closes the chunks of the index, searches that are still running can
+// finish but the index can't be searched after
+func (idx *Index) Close() {
+	idx.pool.close()
+	idx.Keys.Close()
+}
+
+func IsValidMode(mode model.SearchMode) bool {
+	_, isKeyMode := modeToKeyFunc[mode]
+	_, isNotesMode := modeToNotesMatcher[mode]
+	return isKeyMode || isNotesMode || mode == model.ApproximateSearch
+}
+
+func parseResult(buf []byte) []model.RawResult {
+	var res []model.RawResult
+	for i := 0; i < len(buf); i += constants.PostingSize {
+		var rr model.RawResult
+		rr.AbsTickOffset = binary.LittleEndian.Uint32(buf[i : i+4])
+		rr.FileId = binary.LittleEndian.Uint32(buf[i+4 : i+8])
+		rr.SeqNum = binary.LittleEndian.Uint32(buf[i+8 : i+12])
+		rr.LowNote = buf[i+12]
+		rr.ChordFlag = chord.DeserializeFlags(buf[i+13])
+		rr.RankScore = buf[i+14]
+		res = append(res, rr)
+	}
+	return res
+}
+
+// chunkEntry is the entry of a key in a chunk that's open for reading
+type chunkEntry struct {
+	model.IndexEntry
+	chunk *openChunk
+	pool  *chunkPool
+}
+
+// openChunkEntry opens the chunk with the entry at location, which has to
+// be closed
+func (idx *Index) openChunkEntry(location model.KeyLocation) chunkEntry {
+	oc := idx.pool.acquire(idx.Chunks[location.Chunk].Filename)
+	return chunkEntry{
+		IndexEntry: oc.table.Entry(int(location.Entry)),
+		chunk:      oc,
+		pool:       idx.pool,
+	}
+}
+
+// readPostings reads the postings in the data section from start to end,
+// which has to be the start of a block (or the entry) with prevFile as its
+// PrevFile
+func (ce chunkEntry) readPostings(start uint32, end uint32, prevFile uint32) []model.RawResult {
+	postings, err := chunk.DecodePostings(ce.read(start, end), prevFile)
+	if err != nil {
+		panic("Could not decode postings: " + err.Error())
+	}
+	return parseResult(postings)
+}
+
+// read reads the compressed postings in the data section from start to end
+func (ce chunkEntry) read(start uint32, end uint32) []byte {
+	buf := make([]byte, end-start)
+	_, err := ce.chunk.f.ReadAt(buf, ce.chunk.dataStart+int64(start))
+	if err != nil {
+		panic("Could not read from seeked positon: " + err.Error())
+	}
+	return buf
+}
+
+func (ce chunkEntry) close() {
+	ce.pool.release(ce.chunk)
+}
+
+func (idx *Index) findChordsInChunk(location model.KeyLocation) []model.RawResult {
+	ce := idx.openChunkEntry(location)
+	defer ce.close()
+	return ce.readPostings(ce.Start, ce.End, 0)
+}
+
+func (idx *Index) findChordsByKey(chordKey string) []model.RawResult {
+	locations, _ := idx.Keys.Find(chordKey)
+	return idx.findChordsAt(locations)
+}
+
+// findChordsAt finds the chords of a key in every chunk it's in
+func (idx *Index) findChordsAt(locations []model.KeyLocation) []model.RawResult {
+	// NOTE: incremental indexing adds delta chunks that can have the same
+	// keys as older chunks so a key can be in more than one chunk
+	var res []model.RawResult
+	for _, location := range locations {
+		res = append(res, idx.findChordsInChunk(location)...)
+	}
+	if len(idx.DeletedFiles) == 0 {
+		return res
+	}
+
+	// removed files are only taken out of chunks when compacting
+	var kept []model.RawResult
+	for _, r := range res {
+		if !idx.DeletedFiles[r.FileId] {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// FindChords finds the chords that match notes. Searches that go through
+// many keys only search constants.MaxKeysPerQuery of them, it returns true
+// when some were left out.
+func (idx *Index) FindChords(notes model.Notes, opts Options) ([]model.RawResult, bool) {
+	var empty []model.RawResult
+
+	if len(notes) == 0 {
+		return empty, false
+	}
+
+	if opts.Mode == model.ApproximateSearch {
+		return idx.findNearChords(notes, opts.MaxDistance)
+	}
+
+	if matcher, ok := modeToNotesMatcher[opts.Mode]; ok {
+		return idx.findRelatedChords(notes, matcher, modeToKeyPrefixes[opts.Mode])
+	}
+
+	// NOTE: key funcs sort notes so notes[0] is the lowest afterwards
+	res := idx.findChordsByKey(modeToKeyFunc[opts.Mode](notes))
+	if opts.Mode == model.TransposedSearch {
+		for i := range res {
+			res[i].Transposition = int8(int(res[i].LowNote) - int(notes[0]))
+		}
+	}
+	return res, false
+}
@@ -0,0 +1,67 @@
+package tonality
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/jsphweid/harmondex/model"
+)
+
+// Krumhansl-Kessler key profiles, starting from the tonic
+var majorProfile = [12]float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88}
+var minorProfile = [12]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+
+var pitchClassNames = []string{"C", "C#", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+
+func correlate(histogram [12]float64, profile [12]float64, tonic int) float64 {
+	var histMean, profMean float64
+	for i := 0; i < 12; i++ {
+		histMean += histogram[i] / 12
+		profMean += profile[i] / 12
+	}
+
+	var num, histVar, profVar float64
+	for i := 0; i < 12; i++ {
+		h := histogram[(i+tonic)%12] - histMean
+		p := profile[i] - profMean
+		num += h * p
+		histVar += h * h
+		profVar += p * p
+	}
+	if histVar == 0 {
+		return 0
+	}
+	return num / math.Sqrt(histVar*profVar)
+}
+
+// Estimate guesses the key of a whole file from how often each pitch class
+// shows up in its chords
+func Estimate(chords []model.Chord) model.Key {
+	var histogram [12]float64
+	for _, c := range chords {
+		for _, note := range c.Notes {
+			histogram[note%12] += 1
+		}
+	}
+
+	var best model.Key
+	bestScore := math.Inf(-1)
+	for tonic := 0; tonic < 12; tonic++ {
+		if score := correlate(histogram, majorProfile, tonic); score > bestScore {
+			best = model.Key{Tonic: uint8(tonic), IsMinor: false}
+			bestScore = score
+		}
+		if score := correlate(histogram, minorProfile, tonic); score > bestScore {
+			best = model.Key{Tonic: uint8(tonic), IsMinor: true}
+			bestScore = score
+		}
+	}
+	return best
+}
+
+func Name(key model.Key) string {
+	if key.IsMinor {
+		return fmt.Sprintf("%v minor", pitchClassNames[key.Tonic])
+	}
+	return fmt.Sprintf("%v major", pitchClassNames[key.Tonic])
+}
@@ -0,0 +1,36 @@
+package tonality
+
+import (
+	"testing"
+
+	"github.com/jsphweid/harmondex/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeChords(chords ...[]uint8) []model.Chord {
+	var res []model.Chord
+	for _, notes := range chords {
+		res = append(res, model.Chord{Notes: notes})
+	}
+	return res
+}
+
+func TestEstimatesMajorKey(t *testing.T) {
+	// I-IV-V-I in D
+	chords := makeChords([]uint8{62, 66, 69}, []uint8{67, 71, 74}, []uint8{69, 73, 76}, []uint8{62, 66, 69})
+	key := Estimate(chords)
+
+	assert := assert.New(t)
+	assert.Equal(model.Key{Tonic: 2, IsMinor: false}, key)
+	assert.Equal("D major", Name(key))
+}
+
+func TestEstimatesMinorKey(t *testing.T) {
+	// i-iv-V-i in A minor
+	chords := makeChords([]uint8{57, 60, 64}, []uint8{62, 65, 69}, []uint8{64, 68, 71}, []uint8{57, 60, 64})
+	key := Estimate(chords)
+
+	assert := assert.New(t)
+	assert.Equal(model.Key{Tonic: 9, IsMinor: true}, key)
+	assert.Equal("A minor", Name(key))
+}
@@ -19,8 +19,11 @@ func RecreateOutputDir() {
 	os.MkdirAll(dir, 0777)
 }
 
+// GatherAllMidiPaths returns the paths of the midi files in the media dir,
+// relative to it since files in different dirs can have the same name
 func GatherAllMidiPaths(maxNum int) []string {
 	var res []string
+	mediaDir := GetMediaDir()
 	walk := func(s string, d fs.DirEntry, err error) error {
 		name := filepath.Base(s)
 		if err != nil {
@@ -29,13 +32,17 @@ func GatherAllMidiPaths(maxNum int) []string {
 		if !d.IsDir() {
 			if strings.HasSuffix(name, ".mid") || strings.HasSuffix(name, ".midi") {
 				if maxNum == 0 || len(res) < maxNum {
-					res = append(res, name)
+					relPath, err := filepath.Rel(mediaDir, s)
+					if err != nil {
+						panic("Could not make path relative to media dir: " + err.Error())
+					}
+					res = append(res, relPath)
 				}
 			}
 		}
 		return nil
 	}
-	filepath.WalkDir(GetMediaDir(), walk)
+	filepath.WalkDir(mediaDir, walk)
 	return res
 }
 
@@ -69,6 +76,23 @@ func CreateBinary(filename string, data any) {
 	}
 }
 
+// ReplaceBinary is CreateBinary except a crash never leaves a partially
+// written file behind
+func ReplaceBinary(filename string, data any) {
+	tmp := filename + ".tmp"
+	CreateBinary(tmp, data)
+	err := os.Rename(tmp, filename)
+	if err != nil {
+		panic("Could not replace " + filename + ": " + err.Error())
+	}
+}
+
+// Exists reports whether there's a file at path
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
 func OpenFileOrPanic(path string) *os.File {
 	f, err := os.Open(path)
 	if err != nil {
@@ -125,6 +149,13 @@ func Sum[A constraints.Integer](nums []A) uint64 {
 	return total
 }
 
+func Max[A constraints.Integer](num1 A, num2 A) A {
+	if num1 > num2 {
+		return num1
+	}
+	return num2
+}
+
 func GetIndexDir() string {
 	path := os.Getenv("INDEX_PATH")
 	if path != "" {
@@ -142,6 +173,10 @@ func GetMediaDir() string {
 	panic("MEDIA_PATH environment variable is not set!")
 }
 
+func GetBucketDir() string {
+	return filepath.Join(GetIndexDir(), constants.BucketDirname)
+}
+
 func GetFileNumToNamePath() string {
 	return filepath.Join(GetIndexDir(), constants.FileNumToNameFilename)
 }
@@ -149,3 +184,43 @@ func GetFileNumToNamePath() string {
 func GetAllChunksPath() string {
 	return filepath.Join(GetIndexDir(), constants.AllChunksFilename)
 }
+
+func GetKeyDictionaryPath() string {
+	return filepath.Join(GetIndexDir(), constants.KeyDictionaryFilename)
+}
+
+func GetKeySamplePath() string {
+	return filepath.Join(GetIndexDir(), constants.KeySampleFilename)
+}
+
+func GetFileKeysPath() string {
+	return filepath.Join(GetIndexDir(), constants.FileKeysFilename)
+}
+
+func GetFileHashesPath() string {
+	return filepath.Join(GetIndexDir(), constants.FileHashesFilename)
+}
+
+func GetAlternatePathsPath() string {
+	return filepath.Join(GetIndexDir(), constants.AlternatePathsFilename)
+}
+
+func GetManifestPath() string {
+	return filepath.Join(GetIndexDir(), constants.ManifestFilename)
+}
+
+func GetBucketCheckpointPath() string {
+	return filepath.Join(GetBucketDir(), constants.BucketCheckpointFilename)
+}
+
+func GetChunkCheckpointPath() string {
+	return filepath.Join(GetIndexDir(), constants.ChunkCheckpointFilename)
+}
+
+func GetDeletedFilesPath() string {
+	return filepath.Join(GetIndexDir(), constants.DeletedFilesFilename)
+}
+
+func GetRemovedFilesPath() string {
+	return filepath.Join(GetIndexDir(), constants.RemovedFilesFilename)
+}